@@ -0,0 +1,394 @@
+/**
+ * (C) Copyright IBM Corp. 2022.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Event-Notifications/push-en-migration-tool/config"
+	"github.com/Event-Notifications/push-en-migration-tool/secret"
+)
+
+// defaultConfigFile is the configuration file read when it exists and no
+// other file is given.
+const defaultConfigFile = "push-en-migrate.toml"
+
+// configField is a setting of a configuration profile. A field fills a
+// settings value that was not set in the environment, or sets a flag of the
+// command that was not given on the command line, or both.
+type configField struct {
+	key     string
+	setting func(s *settings) *string
+	// flags maps a command to the flag the value sets. The command ""
+	// matches the other commands having that flag.
+	flags map[string]string
+	check func(v string) error
+	// secret fields may hold a file:, env:, stdin: or keystore: reference
+	// and their values are never printed.
+	secret bool
+}
+
+func allFlags(name string) map[string]string { return map[string]string{"": name} }
+
+var configFields = []configField{
+	{key: "push.region", setting: func(s *settings) *string { return &s.PushRegion }, check: checkPushRegion},
+	{key: "push.instance_id", setting: func(s *settings) *string { return &s.PushInstanceID }},
+	{key: "push.apikey", setting: func(s *settings) *string { return &s.PushAPIKey }, check: secret.Check, secret: true},
+	{key: "push.client_secret", setting: func(s *settings) *string { return &s.PushClientSecret }, check: secret.Check, secret: true},
+	{key: "push.app_secret", setting: func(s *settings) *string { return &s.PushAppSecret }, check: secret.Check, secret: true},
+	{key: "push.iam_url", setting: func(s *settings) *string { return &s.PushIAMURL }, check: checkEndpoint},
+	{key: "push.trusted_profile_id", setting: func(s *settings) *string { return &s.PushProfileID }},
+	{key: "push.cr_token_file", setting: func(s *settings) *string { return &s.PushCRTokenFile }},
+	{key: "push.endpoint", setting: func(s *settings) *string { return &s.PushEndpoint }, check: checkEndpoint},
+
+	{key: "en.region", setting: func(s *settings) *string { return &s.ENRegion }, check: checkENRegion},
+	{key: "en.instance_id", setting: func(s *settings) *string { return &s.ENInstanceID }},
+	{key: "en.apikey", setting: func(s *settings) *string { return &s.ENAPIKey }, check: secret.Check, secret: true},
+	{key: "en.ios_destination_id", setting: func(s *settings) *string { return &s.ENIOSDestinationID }},
+	{key: "en.android_destination_id", setting: func(s *settings) *string { return &s.ENAndroidDestinationID }},
+	{key: "en.iam_url", setting: func(s *settings) *string { return &s.ENIAMURL }, check: checkEndpoint},
+	{key: "en.trusted_profile_id", setting: func(s *settings) *string { return &s.ENProfileID }},
+	{key: "en.cr_token_file", setting: func(s *settings) *string { return &s.ENCRTokenFile }},
+	{key: "en.endpoint", setting: func(s *settings) *string { return &s.ENEndpoint }, check: checkEndpoint},
+
+	{key: "export.concurrency", flags: allFlags("concurrency"), check: checkPositive},
+	{key: "export.push_auth", flags: allFlags("push-auth"), check: checkPushAuth},
+
+	{key: "import.workers", flags: allFlags("workers"), check: checkPositive},
+	{key: "import.adaptive", flags: allFlags("adaptive"), check: checkBool},
+	{key: "import.max_workers", flags: allFlags("max-workers"), check: checkPositive},
+	{key: "import.target_latency", flags: allFlags("target-latency"), check: checkDuration},
+	{key: "import.rate", flags: allFlags("rate"), check: checkFloat},
+	{key: "import.burst", flags: allFlags("burst"), check: checkPositive},
+	{key: "import.max_attempts", flags: allFlags("max-attempts"), check: checkPositive},
+	{key: "import.retry_base_delay", flags: allFlags("retry-base-delay"), check: checkDuration},
+	{key: "import.retry_max_delay", flags: allFlags("retry-max-delay"), check: checkDuration},
+	{key: "import.max_failures", flags: allFlags("max-failures"), check: func(v string) error { return new(failureThreshold).Set(v) }},
+	{key: "import.control_socket", flags: allFlags("control-socket")},
+	{key: "drain_timeout", flags: allFlags("drain-timeout"), check: checkDuration},
+
+	{key: "files.devices", flags: map[string]string{"export devices": "output", "import devices": "input", "": "devices-file"}},
+	{key: "files.subscriptions", flags: map[string]string{"export subscriptions": "output", "import subscriptions": "input", "": "subscriptions-file"}},
+	{key: "files.devices_journal", flags: map[string]string{"import devices": "journal", "": "devices-journal"}},
+	{key: "files.subscriptions_journal", flags: map[string]string{"import subscriptions": "journal", "": "subscriptions-journal"}},
+}
+
+// flagFor returns the flag the field sets on the command fs.
+func (f configField) flagFor(fs *flag.FlagSet) string {
+	name, ok := f.flags[fs.Name()]
+	if !ok {
+		name = f.flags[""]
+	}
+	if name == "" || fs.Lookup(name) == nil {
+		return ""
+	}
+	return name
+}
+
+func checkPositive(v string) error {
+	if n, err := strconv.Atoi(v); err != nil || n < 1 {
+		return errors.New("want a whole number of at least 1")
+	}
+	return nil
+}
+
+func checkFloat(v string) error {
+	if f, err := strconv.ParseFloat(v, 64); err != nil || f < 0 {
+		return errors.New("want a number of at least 0")
+	}
+	return nil
+}
+
+func checkBool(v string) error {
+	if _, err := strconv.ParseBool(v); err != nil {
+		return errors.New("want true or false")
+	}
+	return nil
+}
+
+func checkDuration(v string) error {
+	if _, err := time.ParseDuration(v); err != nil {
+		return errors.New(`want a duration such as "500ms" or "2s"`)
+	}
+	return nil
+}
+
+func checkPushAuth(v string) error {
+	switch v {
+	case pushAuthIAM, pushAuthClientSecret, pushAuthAppSecret:
+		return nil
+	}
+	return fmt.Errorf("want %s, %s or %s", pushAuthIAM, pushAuthClientSecret, pushAuthAppSecret)
+}
+
+func checkPushRegion(v string) error {
+	if r, private, ok := lookupRegion(v); !ok || !r.push || private {
+		return fmt.Errorf("want one of %s", regionNames(true))
+	}
+	return nil
+}
+
+func checkENRegion(v string) error {
+	if _, _, ok := lookupRegion(v); !ok {
+		return fmt.Errorf("want one of %s or private.<region>", regionNames(false))
+	}
+	return nil
+}
+
+func checkEndpoint(v string) error {
+	_, err := parseEndpoint(v)
+	return err
+}
+
+// configOptions select the configuration file and profile of a command.
+type configOptions struct {
+	Path    string
+	Profile string
+}
+
+func registerConfigFlags(fs *flag.FlagSet) *configOptions {
+	o := &configOptions{}
+	fs.StringVar(&o.Path, "config", os.Getenv("PUSH_EN_MIGRATE_CONFIG"), "configuration file, "+defaultConfigFile+" if it exists")
+	fs.StringVar(&o.Profile, "profile", os.Getenv("PUSH_EN_MIGRATE_PROFILE"), "profile of the configuration file to use, by default its profile setting")
+	return o
+}
+
+// load reads the configuration file, or returns a nil file if none is
+// given and the default one does not exist.
+func (o *configOptions) load() (*config.File, error) {
+	path := o.Path
+	if path == "" {
+		if _, err := os.Stat(defaultConfigFile); errors.Is(err, os.ErrNotExist) {
+			if o.Profile != "" {
+				return nil, fmt.Errorf("profile %q given without a configuration file", o.Profile)
+			}
+			return nil, nil
+		}
+		path = defaultConfigFile
+	}
+	return config.Load(path)
+}
+
+// selectProfile returns the name of the profile of file to use: the one
+// given, the one named by its profile setting, or its only profile.
+func (o *configOptions) selectProfile(file *config.File) (string, error) {
+	profiles := file.Profiles()
+	name := o.Profile
+	if name == "" {
+		if v, ok := file.Get("profile"); ok {
+			name = v.Text
+		} else if len(profiles) == 1 {
+			name = profiles[0]
+		}
+	}
+	switch {
+	case len(profiles) == 0:
+		return "", fmt.Errorf("%s has no [profiles.<name>] tables", file.Path)
+	case name == "":
+		return "", fmt.Errorf("%s has several profiles, select one of %s with --profile", file.Path, strings.Join(profiles, ", "))
+	case !slices.Contains(profiles, name):
+		return "", fmt.Errorf("%s has no profile %q, want one of %s", file.Path, name, strings.Join(profiles, ", "))
+	}
+	return name, nil
+}
+
+// apply fills the settings not set in the environment and the flags not
+// given on the command line from the selected profile. It must be called
+// after fs is parsed.
+func (o *configOptions) apply(fs *flag.FlagSet, s *settings) error {
+	file, err := o.load()
+	if err != nil || file == nil {
+		return err
+	}
+	name, err := o.selectProfile(file)
+	if err != nil {
+		return err
+	}
+	values, _ := file.Profile(name)
+	if problems := checkProfile(values); len(problems) > 0 {
+		return fmt.Errorf("profile %s of %s is invalid, run \"push-en-migrate config validate\":\n  %s",
+			name, file.Path, strings.Join(problems, "\n  "))
+	}
+
+	given := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	for _, field := range configFields {
+		v, ok := values[field.key]
+		if !ok {
+			continue
+		}
+		if field.setting != nil {
+			if p := field.setting(s); *p == "" {
+				*p = v.Text
+			}
+		}
+		if flagName := field.flagFor(fs); flagName != "" && !given[flagName] {
+			if err := fs.Set(flagName, v.Text); err != nil {
+				return fmt.Errorf("%s line %d: %s: %w", file.Path, v.Line, field.key, err)
+			}
+		}
+	}
+	fmt.Println("Using profile", name, "of", file.Path)
+	return nil
+}
+
+// checkProfile returns the unknown and malformed fields of a profile.
+func checkProfile(values map[string]config.Value) []string {
+	var problems []string
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		v := values[key]
+		i := slices.IndexFunc(configFields, func(f configField) bool { return f.key == key })
+		if i < 0 {
+			problems = append(problems, fmt.Sprintf("line %d: unknown field %s", v.Line, key))
+			continue
+		}
+		if check := configFields[i].check; check != nil {
+			if err := check(v.Text); err != nil && configFields[i].secret {
+				problems = append(problems, fmt.Sprintf("line %d: %s: %v", v.Line, key, err))
+			} else if err != nil {
+				problems = append(problems, fmt.Sprintf("line %d: %s = %q: %v", v.Line, key, v.Text, err))
+			}
+		}
+	}
+	return problems
+}
+
+// missingSettings returns the settings a migration authenticating with Push
+// in the pushAuth mode needs that s lacks.
+func missingSettings(s settings, pushAuth string) []string {
+	var missing []string
+	need := func(ok bool, what string) {
+		if !ok {
+			missing = append(missing, what)
+		}
+	}
+	need(s.PushRegion != "" || s.PushEndpoint != "", "push.region (PUSH_INSTANCE_REGION) or push.endpoint")
+	need(s.PushInstanceID != "", "push.instance_id (PUSH_INSTANCE_ID)")
+	switch pushAuth {
+	case pushAuthClientSecret:
+		need(s.PushClientSecret != "", "push.client_secret (PUSH_CLIENT_SECRET)")
+	case pushAuthAppSecret:
+		need(s.PushAppSecret != "", "push.app_secret (PUSH_APP_SECRET)")
+	default:
+		need(s.PushAPIKey != "" || s.PushProfileID != "", "push.apikey (PUSH_APIKEY) or push.trusted_profile_id")
+	}
+	need(s.ENRegion != "" || s.ENEndpoint != "", "en.region (EN_INSTANCE_REGION) or en.endpoint")
+	need(s.ENInstanceID != "", "en.instance_id (EN_INSTANCE_ID)")
+	need(s.ENAPIKey != "" || s.ENProfileID != "", "en.apikey (EN_APIKEY) or en.trusted_profile_id")
+	need(s.ENIOSDestinationID != "", "en.ios_destination_id (EN_IOS_DESTINATION_ID)")
+	need(s.ENAndroidDestinationID != "", "en.android_destination_id (EN_ANDROID_DESTINATION_ID)")
+	return missing
+}
+
+// runConfigValidate reports every unknown, malformed or missing field of
+// the profiles of the configuration file, combined with the environment.
+func runConfigValidate(args []string) error {
+	fs := flag.NewFlagSet("config validate", flag.ExitOnError)
+	o := registerConfigFlags(fs)
+	var pushAuth string
+	registerPushAuth(fs, &pushAuth)
+	fs.Parse(args)
+	pushAuthSet := false
+	fs.Visit(func(f *flag.Flag) { pushAuthSet = pushAuthSet || f.Name == "push-auth" })
+
+	file, err := o.load()
+	if err != nil {
+		return err
+	}
+	if file == nil {
+		return fmt.Errorf("no configuration file, create %s or use --config", defaultConfigFile)
+	}
+
+	var problems []string
+	for _, key := range file.Keys() {
+		if key != "profile" {
+			v, _ := file.Get(key)
+			problems = append(problems, fmt.Sprintf("line %d: unknown field %s", v.Line, key))
+		}
+	}
+	names := file.Profiles()
+	if len(names) == 0 {
+		problems = append(problems, "no [profiles.<name>] tables")
+	}
+	if v, ok := file.Get("profile"); ok && !slices.Contains(names, v.Text) {
+		problems = append(problems, fmt.Sprintf("line %d: profile %q is not defined", v.Line, v.Text))
+	}
+	if o.Profile != "" {
+		names = []string{o.Profile}
+	}
+	if len(problems) > 0 {
+		fmt.Println(file.Path + ":")
+		printProblems(problems)
+	}
+
+	invalid := len(problems)
+	for _, name := range names {
+		values, ok := file.Profile(name)
+		if !ok {
+			return fmt.Errorf("%s has no profile %q, want one of %s", file.Path, name, strings.Join(file.Profiles(), ", "))
+		}
+		problems := checkProfile(values)
+
+		s := loadSettings()
+		for _, field := range configFields {
+			if v, ok := values[field.key]; ok && field.setting != nil {
+				if p := field.setting(&s); *p == "" {
+					*p = v.Text
+				}
+			}
+		}
+		// The profile may choose how the export authenticates with Push,
+		// unless --push-auth does.
+		mode := pushAuth
+		if v, ok := values["export.push_auth"]; ok && !pushAuthSet {
+			mode = v.Text
+		}
+		for _, what := range missingSettings(s, mode) {
+			problems = append(problems, "missing "+what)
+		}
+
+		if len(problems) == 0 {
+			fmt.Println("Profile", name+": ok")
+			continue
+		}
+		fmt.Println("Profile", name+":")
+		printProblems(problems)
+		invalid += len(problems)
+	}
+	if invalid > 0 {
+		return fmt.Errorf("%s has %d problems", file.Path, invalid)
+	}
+	return nil
+}
+
+func printProblems(problems []string) {
+	for _, p := range problems {
+		fmt.Println("  " + p)
+	}
+}
@@ -0,0 +1,296 @@
+/**
+ * (C) Copyright IBM Corp. 2022.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Event-Notifications/push-en-migration-tool/throttle"
+)
+
+// defaultControlSocket is the socket the control commands connect to by
+// default.
+const defaultControlSocket = "push-en-migrate.sock"
+
+// controller serves the control socket of a process and acts on the worker
+// pool of the import running at the time. Pausing holds for the imports
+// started later by the same process, such as the subscriptions after the
+// devices of migrate all.
+type controller struct {
+	maxWorkers int
+
+	mu      sync.Mutex
+	paused  bool
+	name    string
+	limiter *throttle.Limiter
+	sum     *summary
+	started time.Time
+}
+
+// controlStatus is the reply to the status command.
+type controlStatus struct {
+	// Import is the kind of rows being imported, empty between imports.
+	Import     string    `json:"import,omitempty"`
+	Paused     bool      `json:"paused"`
+	Workers    int       `json:"workers"`
+	MaxWorkers int       `json:"max_workers"`
+	InFlight   int       `json:"in_flight"`
+	Migrated   int       `json:"migrated"`
+	Existing   int       `json:"existing"`
+	Failed     int       `json:"failed"`
+	Started    time.Time `json:"started"`
+}
+
+// serveControl starts serving o.ControlSocket, if set, and returns a
+// function that stops it and removes the socket.
+func (o *poolOptions) serveControl() (func(), error) {
+	if o.ControlSocket == "" {
+		return func() {}, nil
+	}
+	l, err := listenControl(o.ControlSocket)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &controller{maxWorkers: o.goroutines()}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /status", c.handleStatus)
+	mux.HandleFunc("POST /pause", c.handlePause)
+	mux.HandleFunc("POST /resume", c.handleResume)
+	mux.HandleFunc("POST /workers", c.handleWorkers)
+	srv := &http.Server{Handler: mux}
+	go srv.Serve(l)
+
+	o.control = c
+	fmt.Println("Accepting control commands on", o.ControlSocket)
+	return func() { srv.Close() }, nil
+}
+
+// listenControl listens on the Unix socket path, replacing a socket left
+// behind by a process that did not exit cleanly.
+func listenControl(path string) (net.Listener, error) {
+	l, err := net.Listen("unix", path)
+	if err == nil {
+		return l, nil
+	}
+	if conn, dialErr := net.Dial("unix", path); dialErr == nil {
+		conn.Close()
+		return nil, fmt.Errorf("control socket %s is in use by another migration", path)
+	}
+	if info, statErr := os.Lstat(path); statErr != nil || info.Mode()&os.ModeSocket == 0 {
+		return nil, err
+	}
+	if err := os.Remove(path); err != nil {
+		return nil, err
+	}
+	return net.Listen("unix", path)
+}
+
+// attach points the controller at the pool of the import name.
+func (c *controller) attach(name string, limiter *throttle.Limiter, sum *summary) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.name, c.limiter, c.sum, c.started = name, limiter, sum, time.Now()
+	if c.paused {
+		limiter.Pause()
+	}
+}
+
+// detach forgets the pool of the import that finished.
+func (c *controller) detach() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.name, c.limiter, c.sum = "", nil, nil
+}
+
+func (c *controller) status() controlStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	st := controlStatus{Import: c.name, Paused: c.paused, MaxWorkers: c.maxWorkers}
+	if c.limiter != nil {
+		st.Workers = c.limiter.Limit()
+		st.InFlight = c.limiter.InUse()
+		st.Migrated, st.Existing, st.Failed = c.sum.counts()
+		st.Started = c.started
+	}
+	return st
+}
+
+func (c *controller) handleStatus(w http.ResponseWriter, r *http.Request) {
+	writeStatus(w, c.status())
+}
+
+func (c *controller) handlePause(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	if !c.paused {
+		fmt.Println("Pausing import, waiting for requests in flight to finish")
+	}
+	c.paused = true
+	if c.limiter != nil {
+		c.limiter.Pause()
+	}
+	c.mu.Unlock()
+	writeStatus(w, c.status())
+}
+
+func (c *controller) handleResume(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	if c.paused {
+		fmt.Println("Resuming import")
+	}
+	c.paused = false
+	if c.limiter != nil {
+		c.limiter.Resume()
+	}
+	c.mu.Unlock()
+	writeStatus(w, c.status())
+}
+
+func (c *controller) handleWorkers(w http.ResponseWriter, r *http.Request) {
+	n, err := strconv.Atoi(r.FormValue("n"))
+	if err != nil || n < 1 || n > c.maxWorkers {
+		http.Error(w, fmt.Sprintf("workers must be between 1 and %d", c.maxWorkers), http.StatusBadRequest)
+		return
+	}
+	c.mu.Lock()
+	if c.limiter == nil {
+		c.mu.Unlock()
+		http.Error(w, "no import is running", http.StatusConflict)
+		return
+	}
+	fmt.Println("Setting workers to", n)
+	c.limiter.SetLimit(n)
+	c.mu.Unlock()
+	writeStatus(w, c.status())
+}
+
+func writeStatus(w http.ResponseWriter, st controlStatus) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(st)
+}
+
+func runPause(args []string) error {
+	return runControl("pause", args, "POST", "/pause", nil)
+}
+
+func runResume(args []string) error {
+	return runControl("resume", args, "POST", "/resume", nil)
+}
+
+func runStatus(args []string) error {
+	return runControl("status", args, "GET", "/status", nil)
+}
+
+func runSetWorkers(args []string) error {
+	return runControl("set-workers", args, "POST", "/workers", func(args []string) (url.Values, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("%w: set-workers takes the number of workers", errUsage)
+		}
+		if _, err := strconv.Atoi(args[0]); err != nil {
+			return nil, fmt.Errorf("%w: invalid number of workers %q", errUsage, args[0])
+		}
+		return url.Values{"n": {args[0]}}, nil
+	})
+}
+
+// runControl sends a command to the control socket of a running import
+// and prints the status it replies with. The arguments other than flags,
+// which may come before or after them, are passed to form.
+func runControl(name string, args []string, method, path string, form func(args []string) (url.Values, error)) error {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	socket := fs.String("control-socket", defaultControlSocket, "control socket of the running import")
+	fs.Parse(args)
+	var positional []string
+	for fs.NArg() > 0 {
+		positional = append(positional, fs.Arg(0))
+		fs.Parse(fs.Args()[1:])
+	}
+
+	var values url.Values
+	if form != nil {
+		var err error
+		if values, err = form(positional); err != nil {
+			return err
+		}
+	} else if len(positional) > 0 {
+		return fmt.Errorf("%w: %s takes no arguments", errUsage, name)
+	}
+
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", *socket)
+			},
+		},
+	}
+	u := "http://control" + path
+	if values != nil {
+		u += "?" + values.Encode()
+	}
+	req, err := http.NewRequest(method, u, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("no migration is listening on %s, start the import with --control-socket %s: %w", *socket, *socket, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return errors.New(strings.TrimSpace(string(body)))
+	}
+
+	var st controlStatus
+	if err := json.Unmarshal(body, &st); err != nil {
+		return err
+	}
+	printStatus(st)
+	return nil
+}
+
+func printStatus(st controlStatus) {
+	state := "running"
+	if st.Paused {
+		state = "paused"
+	}
+	if st.Import == "" {
+		fmt.Println("No import running,", state)
+		return
+	}
+	fmt.Println("Importing", st.Import+",", state, "for", time.Since(st.Started).Round(time.Second))
+	fmt.Printf("Workers: %d of at most %d, %d requests in flight\n", st.Workers, st.MaxWorkers, st.InFlight)
+	fmt.Println("Rows:", st.Migrated, "migrated,", st.Existing, "already existed,", st.Failed, "failed")
+}
@@ -0,0 +1,462 @@
+/**
+ * (C) Copyright IBM Corp. 2022.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/Event-Notifications/push-en-migration-tool/journal"
+	"github.com/Event-Notifications/push-en-migration-tool/pushsource"
+)
+
+// exportOptions are the files and concurrency used by an export.
+type exportOptions struct {
+	Output      string
+	Resume      bool
+	Concurrency int
+	// DrainTimeout is how long pages in flight may take to arrive once the
+	// export is asked to stop.
+	DrainTimeout time.Duration
+	// PushAuth is how requests to Push are authenticated, one of the
+	// pushAuth modes.
+	PushAuth string
+}
+
+func (o *exportOptions) register(fs *flag.FlagSet, output string) {
+	fs.StringVar(&o.Output, "output", output, "file to write the export to")
+	fs.BoolVar(&o.Resume, "resume", false, "continue from the last page recorded in the checkpoint file")
+	fs.IntVar(&o.Concurrency, "concurrency", 4, "maximum number of pages fetched from Push at once")
+	fs.DurationVar(&o.DrainTimeout, "drain-timeout", 30*time.Second, "time given to pages in flight to arrive after SIGINT or SIGTERM")
+	registerPushAuth(fs, &o.PushAuth)
+}
+
+// checkpointPath returns the checkpoint file of an export output.
+func (o exportOptions) checkpointPath() string {
+	return o.Output + ".checkpoint"
+}
+
+func runExportDevices(args []string) error {
+	fs := flag.NewFlagSet("export devices", flag.ExitOnError)
+	var opts exportOptions
+	opts.register(fs, "devices.csv")
+	s := loadSettings()
+	s.registerPushFlags(fs)
+	cfg := registerConfigFlags(fs)
+	fs.Parse(args)
+	if err := cfg.apply(fs, &s); err != nil {
+		return err
+	}
+
+	ctx, cancel := signalContext(opts.DrainTimeout)
+	defer cancel()
+	return exportDevices(ctx, s, opts)
+}
+
+func runExportSubscriptions(args []string) error {
+	fs := flag.NewFlagSet("export subscriptions", flag.ExitOnError)
+	var opts exportOptions
+	opts.register(fs, "subscription.csv")
+	s := loadSettings()
+	s.registerPushFlags(fs)
+	cfg := registerConfigFlags(fs)
+	fs.Parse(args)
+	if err := cfg.apply(fs, &s); err != nil {
+		return err
+	}
+
+	ctx, cancel := signalContext(opts.DrainTimeout)
+	defer cancel()
+	return exportSubscriptions(ctx, s, opts)
+}
+
+// Modes of authentication with Push.
+const (
+	pushAuthIAM          = "iam"
+	pushAuthClientSecret = "client-secret"
+	pushAuthAppSecret    = "app-secret"
+)
+
+func registerPushAuth(fs *flag.FlagSet, mode *string) {
+	fs.StringVar(mode, "push-auth", pushAuthIAM, "authentication with Push: iam with PUSH_APIKEY or a trusted profile, client-secret with PUSH_CLIENT_SECRET, or app-secret with PUSH_APP_SECRET")
+}
+
+// newPushClient returns a client for the Push instance authenticating with
+// the pushAuth mode.
+func newPushClient(s settings, pushAuth string) (*pushsource.Client, error) {
+	baseURL, err := pushURL(s.PushRegion, s.PushEndpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	var auth pushsource.Auth
+	switch pushAuth {
+	case pushAuthIAM:
+		creds, err := s.pushCredentials()
+		if err != nil {
+			return nil, err
+		}
+		auth = pushsource.IAMAuth{Tokens: authenticator(creds)}
+	case pushAuthClientSecret:
+		if s.PushClientSecret == "" {
+			return nil, errors.New("PUSH_CLIENT_SECRET is not set, please check setEnv.sh and source it")
+		}
+		secret, err := resolveSecret("PUSH_CLIENT_SECRET", s.PushClientSecret)
+		if err != nil {
+			return nil, err
+		}
+		auth = pushsource.ClientSecretAuth{Secret: secret}
+	case pushAuthAppSecret:
+		if s.PushAppSecret == "" {
+			return nil, errors.New("PUSH_APP_SECRET is not set, please check setEnv.sh and source it")
+		}
+		secret, err := resolveSecret("PUSH_APP_SECRET", s.PushAppSecret)
+		if err != nil {
+			return nil, err
+		}
+		auth = pushsource.AppSecretAuth{Secret: secret}
+	default:
+		return nil, fmt.Errorf("%w: unknown --push-auth %q, want %s, %s or %s",
+			errUsage, pushAuth, pushAuthIAM, pushAuthClientSecret, pushAuthAppSecret)
+	}
+	return pushsource.NewClient(baseURL, s.PushInstanceID, auth), nil
+}
+
+func exportDevices(ctx context.Context, s settings, opts exportOptions) error {
+	client, err := newPushClient(s, opts.PushAuth)
+	if err != nil {
+		return err
+	}
+
+	err = exportPages(ctx, opts, client.DevicesURL(0), func(ctx context.Context, pageURL string) (*exportPage, error) {
+		page, err := client.GetDevicePage(ctx, pageURL)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Println("Getting device with push device url", pageURL)
+
+		records := make([][]string, 0, len(page.Devices))
+		for _, device := range page.Devices {
+			records = append(records, deviceRecord(device))
+		}
+		return &exportPage{records: records, next: page.PageInfo.Next, total: page.PageInfo.TotalCount}, nil
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Println("Finished getting device")
+	return nil
+}
+
+func exportSubscriptions(ctx context.Context, s settings, opts exportOptions) error {
+	client, err := newPushClient(s, opts.PushAuth)
+	if err != nil {
+		return err
+	}
+
+	err = exportPages(ctx, opts, client.SubscriptionsURL(0), func(ctx context.Context, pageURL string) (*exportPage, error) {
+		page, err := client.GetSubscriptionPage(ctx, pageURL)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Println("Getting Subscription from url ", pageURL)
+
+		records := make([][]string, 0, len(page.Subscriptions))
+		for _, sub := range page.Subscriptions {
+			if sub.TagName == pushsource.BroadcastTag {
+				continue
+			}
+			records = append(records, subscriptionRecord(sub))
+		}
+		return &exportPage{records: records, next: page.PageInfo.Next, total: page.PageInfo.TotalCount}, nil
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Println("Finished getting subscriptions")
+	return nil
+}
+
+// exportPage is a fetched page converted to CSV records.
+type exportPage struct {
+	records [][]string
+	next    string
+	total   int
+}
+
+// pageFunc fetches the page at pageURL.
+type pageFunc func(ctx context.Context, pageURL string) (*exportPage, error)
+
+// exportPages writes every page starting at first to opts.Output, saving a
+// checkpoint after each page. On resume the output is cut back to the last
+// checkpoint and the export continues from the page it recorded.
+//
+// The first page is fetched on its own to learn the total count. With a
+// concurrency above one the remaining pages are then fetched by offset in
+// parallel and written in offset order; otherwise PageInfo.Next is followed.
+func exportPages(ctx context.Context, opts exportOptions, first string, fetch pageFunc) error {
+	cp := &journal.Checkpoint{Next: first}
+	if opts.Resume {
+		saved, err := journal.LoadCheckpoint(opts.checkpointPath())
+		if err != nil {
+			return fmt.Errorf("failed reading checkpoint: %w", err)
+		}
+		if saved != nil {
+			cp = saved
+		}
+	}
+	if cp.Done {
+		fmt.Println("Export to", opts.Output, "already finished with", cp.Rows, "rows")
+		return nil
+	}
+
+	csvFile, err := os.OpenFile(opts.Output, os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed creating %s: %w", opts.Output, err)
+	}
+	defer csvFile.Close()
+	if err := csvFile.Truncate(cp.Size); err != nil {
+		return err
+	}
+	if _, err := csvFile.Seek(cp.Size, io.SeekStart); err != nil {
+		return err
+	}
+	if cp.Pages > 0 {
+		fmt.Println("Resuming export after page", cp.Pages, "with", cp.Rows, "rows from", cp.Next)
+	}
+
+	csvwriter := csv.NewWriter(csvFile)
+	write := func(page *exportPage, next string) error {
+		if err := csvwriter.WriteAll(page.records); err != nil {
+			return err
+		}
+		if err := csvFile.Sync(); err != nil {
+			return err
+		}
+		size, err := csvFile.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+
+		cp.Next = next
+		cp.Size = size
+		cp.Pages++
+		cp.Rows += len(page.records)
+		cp.Done = next == ""
+		if err := cp.Save(opts.checkpointPath()); err != nil {
+			return fmt.Errorf("failed saving checkpoint: %w", err)
+		}
+		return nil
+	}
+
+	// Pages are only started while the export is not asked to stop; the
+	// checkpoint then records the last page written.
+	interrupt := func() error {
+		fmt.Println("Stopped export after page", cp.Pages, "with", cp.Rows, "rows, progress is saved in", opts.checkpointPath())
+		return errInterrupted
+	}
+	if stopped(ctx) {
+		return interrupt()
+	}
+
+	firstURL := cp.Next
+	page, err := fetch(ctx, firstURL)
+	if err != nil {
+		return err
+	}
+
+	offset, size, ok := pageBounds(firstURL)
+	if opts.Concurrency <= 1 || !ok || page.next == "" {
+		if err := write(page, page.next); err != nil {
+			return err
+		}
+		for cp.Next != "" {
+			if stopped(ctx) {
+				return interrupt()
+			}
+			page, err := fetch(ctx, cp.Next)
+			if err != nil {
+				return err
+			}
+			if err := write(page, page.next); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// The following pages are addressed by offset, so the first page is
+	// followed by the URL of the next offset rather than PageInfo.Next.
+	var offsets []int
+	for o := offset + size; o < page.total; o += size {
+		offsets = append(offsets, o)
+	}
+	nextURL := func(i int) string {
+		if i+1 < len(offsets) {
+			return withOffset(firstURL, offsets[i+1])
+		}
+		return ""
+	}
+	if len(offsets) == 0 {
+		return write(page, "")
+	}
+	if err := write(page, withOffset(firstURL, offsets[0])); err != nil {
+		return err
+	}
+
+	err = fetchOrdered(ctx, len(offsets), opts.Concurrency,
+		func(ctx context.Context, i int) (*exportPage, error) {
+			return fetch(ctx, withOffset(firstURL, offsets[i]))
+		},
+		func(i int, page *exportPage) error {
+			return write(page, nextURL(i))
+		})
+	if errors.Is(err, errInterrupted) {
+		return interrupt()
+	}
+	return err
+}
+
+// fetchOrdered fetches n pages with up to workers requests in flight and
+// passes them to emit in index order. At most twice as many pages as
+// workers are held in memory waiting for an earlier page. Once the command
+// of ctx is asked to stop no further page is started, and errInterrupted is
+// returned after the pages already started are emitted.
+func fetchOrdered(ctx context.Context, n, workers int, fetch func(ctx context.Context, i int) (*exportPage, error), emit func(i int, page *exportPage) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type fetched struct {
+		page *exportPage
+		err  error
+	}
+	slots := make([]chan fetched, n)
+	for i := range slots {
+		slots[i] = make(chan fetched, 1)
+	}
+
+	window := make(chan struct{}, 2*workers)
+	jobs := make(chan int)
+	// started is the number of pages handed to the workers. It is only
+	// read once fed is closed.
+	started := 0
+	fed := make(chan struct{})
+	go func() {
+		defer close(fed)
+		defer close(jobs)
+		for i := 0; i < n; i++ {
+			select {
+			case window <- struct{}{}:
+			case <-stopping(ctx):
+				return
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case jobs <- i:
+			case <-stopping(ctx):
+				return
+			case <-ctx.Done():
+				return
+			}
+			started = i + 1
+		}
+	}()
+
+	for w := 0; w < workers; w++ {
+		go func() {
+			for i := range jobs {
+				page, err := fetch(ctx, i)
+				slots[i] <- fetched{page, err}
+			}
+		}()
+	}
+
+	for i := 0; i < n; i++ {
+		var f fetched
+		select {
+		case f = <-slots[i]:
+		case <-fed:
+			if i >= started {
+				return errInterrupted
+			}
+			select {
+			case f = <-slots[i]:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		<-window
+		if f.err != nil {
+			return f.err
+		}
+		if err := emit(i, f.page); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pageBounds returns the offset and size query parameters of a page URL.
+func pageBounds(pageURL string) (offset, size int, ok bool) {
+	u, err := url.Parse(pageURL)
+	if err != nil {
+		return 0, 0, false
+	}
+	q := u.Query()
+	offset, err = strconv.Atoi(q.Get("offset"))
+	if err != nil {
+		return 0, 0, false
+	}
+	size, err = strconv.Atoi(q.Get("size"))
+	if err != nil || size <= 0 {
+		return 0, 0, false
+	}
+	return offset, size, true
+}
+
+// withOffset returns pageURL with its offset query parameter replaced.
+func withOffset(pageURL string, offset int) string {
+	u, err := url.Parse(pageURL)
+	if err != nil {
+		return pageURL
+	}
+	q := u.Query()
+	q.Set("offset", strconv.Itoa(offset))
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// deviceRecord returns the devices.csv row for d.
+func deviceRecord(d pushsource.Device) []string {
+	return []string{d.DeviceID, d.UserID, d.Token, d.Platform}
+}
+
+// subscriptionRecord returns the subscription.csv row for sub.
+func subscriptionRecord(sub pushsource.Subscription) []string {
+	return []string{sub.TagName, sub.DeviceID}
+}
@@ -0,0 +1,453 @@
+/**
+ * (C) Copyright IBM Corp. 2022.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/Event-Notifications/push-en-migration-tool/deadletter"
+	"github.com/Event-Notifications/push-en-migration-tool/ensink"
+	"github.com/Event-Notifications/push-en-migration-tool/iam"
+	"github.com/Event-Notifications/push-en-migration-tool/journal"
+	"github.com/Event-Notifications/push-en-migration-tool/throttle"
+)
+
+// importer registers devices and tag subscriptions on the EN destinations.
+type importer struct {
+	client       *ensink.Client
+	destinations ensink.Destinations
+	journal      *journal.Journal
+	pool         poolOptions
+	limiter      *throttle.Limiter
+	sink         *resultSink
+	// platforms routes subscriptions to the destination of their device.
+	platforms *devicePlatforms
+}
+
+// importOptions are the files and workers used by an import.
+type importOptions struct {
+	Input   string
+	Journal string
+	Resume  bool
+	Pool    poolOptions
+	// DevicesFile holds the exported devices whose platforms route the
+	// subscriptions.
+	DevicesFile string
+
+	// keepFailures appends to the dead letter file instead of replacing it.
+	keepFailures bool
+}
+
+func (o *importOptions) register(fs *flag.FlagSet, input, journal string) {
+	o.Pool.register(fs)
+	fs.StringVar(&o.Input, "input", input, "exported file to import")
+	fs.StringVar(&o.Journal, "journal", journal, "journal of completed rows")
+	fs.BoolVar(&o.Resume, "resume", false, "skip rows completed by a previous run according to the journal")
+}
+
+func newImporter(ctx context.Context, s settings, pool poolOptions) (*importer, error) {
+	enurl, err := enURL(s.ENRegion, s.ENEndpoint)
+	if err != nil {
+		return nil, err
+	}
+	creds, err := s.enCredentials()
+	if err != nil {
+		return nil, err
+	}
+	auth := authenticator(creds)
+	if _, err := auth.Token(ctx); err != nil {
+		return nil, fmt.Errorf("error processing request please check setEnv.sh and source it: %w", err)
+	}
+
+	imp := &importer{
+		client: ensink.NewClient(enurl, s.ENInstanceID, auth),
+		destinations: ensink.Destinations{
+			IOS:     s.ENIOSDestinationID,
+			Android: s.ENAndroidDestinationID,
+		},
+		pool:    pool,
+		limiter: throttle.NewLimiter(pool.Workers),
+	}
+	imp.client.Retry = pool.Retry
+	if bucket := pool.rateLimiter(s.ENInstanceID); bucket != nil {
+		imp.client.RateLimiter = bucket
+	}
+	if pool.Adaptive {
+		aimd := &throttle.AIMD{
+			Limiter:       imp.limiter,
+			Min:           1,
+			Max:           pool.MaxWorkers,
+			TargetLatency: pool.TargetLatency,
+			Cooldown:      time.Second,
+			OnChange: func(limit int) {
+				fmt.Println("Adjusting workers to", limit)
+			},
+		}
+		imp.client.HTTPClient = &http.Client{Transport: &throttle.Transport{Observe: aimd.Observe}}
+	}
+	return imp, nil
+}
+
+func runImportDevices(args []string) error {
+	fs := flag.NewFlagSet("import devices", flag.ExitOnError)
+	var opts importOptions
+	opts.register(fs, "devices.csv", "devices.journal")
+	s := loadSettings()
+	s.registerENFlags(fs)
+	cfg := registerConfigFlags(fs)
+	fs.Parse(args)
+	if err := cfg.apply(fs, &s); err != nil {
+		return err
+	}
+	if err := opts.Pool.validate(); err != nil {
+		return err
+	}
+
+	ctx, cancel := signalContext(opts.Pool.DrainTimeout)
+	defer cancel()
+	stopControl, err := opts.Pool.serveControl()
+	if err != nil {
+		return err
+	}
+	defer stopControl()
+	return importDevices(ctx, s, opts)
+}
+
+func runImportSubscriptions(args []string) error {
+	fs := flag.NewFlagSet("import subscriptions", flag.ExitOnError)
+	var opts importOptions
+	opts.register(fs, "subscription.csv", "subscription.journal")
+	fs.StringVar(&opts.DevicesFile, "devices-file", "devices.csv", "exported devices whose platforms decide the destination of each subscription")
+	s := loadSettings()
+	s.registerENFlags(fs)
+	cfg := registerConfigFlags(fs)
+	fs.Parse(args)
+	if err := cfg.apply(fs, &s); err != nil {
+		return err
+	}
+	if err := opts.Pool.validate(); err != nil {
+		return err
+	}
+
+	ctx, cancel := signalContext(opts.Pool.DrainTimeout)
+	defer cancel()
+	stopControl, err := opts.Pool.serveControl()
+	if err != nil {
+		return err
+	}
+	defer stopControl()
+	return importSubscriptions(ctx, s, opts)
+}
+
+func importDevices(ctx context.Context, s settings, opts importOptions) error {
+	imp, err := newImporter(ctx, s, opts.Pool)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(opts.Input)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return imp.run(ctx, opts, imp.devices(), csvRecords(file))
+}
+
+func importSubscriptions(ctx context.Context, s settings, opts importOptions) error {
+	imp, err := newImporter(ctx, s, opts.Pool)
+	if err != nil {
+		return err
+	}
+	if imp.platforms, err = loadDevicePlatforms(opts.DevicesFile); err != nil {
+		return err
+	}
+	file, err := os.Open(opts.Input)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return imp.run(ctx, opts, imp.subscriptions(), csvRecords(file))
+}
+
+// csvRecords returns a record iterator over the CSV file r. Rows may have
+// any number of fields so that a malformed row fails on its own, and a row
+// that cannot be parsed returns an error matching ensink.ErrInvalidRow
+// after which reading may go on.
+func csvRecords(r io.Reader) func() ([]string, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	return func() ([]string, error) {
+		record, err := reader.Read()
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			return nil, fmt.Errorf("%w: %w", ensink.ErrInvalidRow, err)
+		}
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("check for mentioned line for missing information: %w", err)
+		}
+		return record, err
+	}
+}
+
+// errTooManyFailures is returned by an import that ran through its input
+// but failed more rows than --max-failures allows.
+var errTooManyFailures = errors.New("too many failures")
+
+// importTarget describes one kind of record to import.
+type importTarget struct {
+	name       string
+	failedFile string
+	succFile   string
+	// fields is the number of fields of a record.
+	fields int
+	// key returns the journal key of a record with enough fields.
+	key  func(record []string) []string
+	post postFunc
+}
+
+// checkFields returns an error matching ensink.ErrInvalidRow if record has
+// fewer than the fields of target.
+func (target importTarget) checkFields(record []string) error {
+	if len(record) < target.fields {
+		return fmt.Errorf("%w: %d fields, want %d", ensink.ErrInvalidRow, len(record), target.fields)
+	}
+	return nil
+}
+
+// devices imports devices.csv records: device ID, user ID, token and
+// platform, keyed by device ID.
+func (imp *importer) devices() importTarget {
+	return importTarget{
+		name:       "devices",
+		failedFile: "failed_devices.jsonl",
+		succFile:   "migrated_devices.csv",
+		fields:     4,
+		key:        func(record []string) []string { return record[:1] },
+		post:       imp.postDevice,
+	}
+}
+
+// subscriptions imports subscription.csv records: tag name and device ID,
+// keyed by both.
+func (imp *importer) subscriptions() importTarget {
+	return importTarget{
+		name:       "subscriptions",
+		failedFile: "failed_subscription.jsonl",
+		succFile:   "migrated_subscription.csv",
+		fields:     2,
+		key:        func(record []string) []string { return record[:2] },
+		post:       imp.postSubscription,
+	}
+}
+
+// run imports the records returned by next until it returns io.EOF.
+func (imp *importer) run(ctx context.Context, opts importOptions, target importTarget, next func() ([]string, error)) error {
+	start := time.Now()
+
+	var err error
+	imp.journal, err = journal.Open(opts.Journal, opts.Resume)
+	if err != nil {
+		return err
+	}
+	defer imp.journal.Close()
+	if opts.Resume {
+		fmt.Println("Resuming, skipping", imp.journal.Len(), "rows already completed in", opts.Journal)
+	}
+
+	// The success file is only appended to on resume since the rows it
+	// already holds are not imported again.
+	succFlags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if opts.Resume {
+		succFlags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+
+	deadLetters, err := deadletter.Create(target.failedFile, opts.keepFailures)
+	if err != nil {
+		return err
+	}
+	csvFileSucc, err := os.OpenFile(target.succFile, succFlags, 0o644)
+	if err != nil {
+		deadLetters.Close()
+		return err
+	}
+	imp.sink = newResultSink(csvFileSucc, deadLetters, imp.journal)
+
+	// Invalid credentials fail every row, so the first one ends the
+	// import instead.
+	ctx, abort := context.WithCancelCause(ctx)
+	defer abort(nil)
+	post := func(ctx context.Context, record []string) error {
+		err := target.post(ctx, record)
+		if errors.Is(err, iam.ErrCredentialsInvalid) {
+			abort(err)
+		}
+		return err
+	}
+
+	streamCtx, stopStream := context.WithCancel(ctx)
+	defer stopStream()
+
+	skip := func(record []string) bool {
+		return target.checkFields(record) == nil && imp.journal.Done(target.key(record)...)
+	}
+	sum := newSummary()
+	inputCh, readErr := streamInputs(streamCtx, imp.skipUnparsable(next, sum), skip)
+
+	if imp.pool.control != nil {
+		imp.pool.control.attach(target.name, imp.limiter, sum)
+		defer imp.pool.control.detach()
+	}
+	err = AsyncHTTP(ctx, inputCh, post, imp.pool.goroutines(), imp.limiter, sum)
+	if err := imp.sink.close(); err != nil {
+		return fmt.Errorf("failed writing results: %w", err)
+	}
+	sum.print(os.Stdout)
+	if cause := context.Cause(ctx); errors.Is(cause, iam.ErrCredentialsInvalid) {
+		return fmt.Errorf("stopped, check the EN API key in setEnv.sh and run again with --resume: %w", cause)
+	}
+	if stopped(ctx) {
+		fmt.Println("Stopped, completed rows are recorded in", opts.Journal)
+		return errInterrupted
+	}
+	if err != nil {
+		return err
+	}
+	if err := <-readErr; err != nil {
+		return err
+	}
+
+	fmt.Println("finished in ", time.Since(start))
+	if imp.pool.MaxFailures.exceeded(sum) {
+		return fmt.Errorf("%w: %d of %d rows failed, more than the --max-failures threshold of %s, see %s",
+			errTooManyFailures, sum.failures(), sum.total(), imp.pool.MaxFailures.String(), target.failedFile)
+	}
+	return nil
+}
+
+// skipUnparsable returns next without the rows that cannot be parsed,
+// which are recorded as failures instead so that the rows after them are
+// still imported.
+func (imp *importer) skipUnparsable(next func() ([]string, error), sum *summary) func() ([]string, error) {
+	return func() ([]string, error) {
+		for {
+			record, err := next()
+			if !errors.Is(err, ensink.ErrInvalidRow) {
+				return record, err
+			}
+			fmt.Println("Failed row:", err)
+			imp.failed(nil, "", err)
+			sum.add(err)
+		}
+	}
+}
+
+// completed records a migrated row in the success file and the journal.
+func (imp *importer) completed(record, key []string) {
+	imp.sink.migrated(record, key)
+}
+
+// failed records a row that could not be migrated in the dead letter file.
+func (imp *importer) failed(record []string, destinationID string, err error) {
+	entry := deadletter.Entry{
+		Record:        record,
+		DestinationID: destinationID,
+		Category:      string(ensink.Classify(err)),
+		Retriable:     ensink.Retriable(err),
+		Error:         err.Error(),
+		Attempts:      ensink.Attempts(err),
+		Time:          time.Now().UTC(),
+	}
+	var apiErr *ensink.APIError
+	if errors.As(err, &apiErr) {
+		entry.StatusCode = apiErr.StatusCode
+		entry.Body = apiErr.Body
+	}
+	imp.sink.failed(entry)
+}
+
+// postDevice registers a devices.csv record: device ID, user ID, token and
+// platform.
+func (imp *importer) postDevice(ctx context.Context, record []string) error {
+	if err := imp.devices().checkFields(record); err != nil {
+		fmt.Println("Failed Device row", record, err)
+		imp.failed(record, "", err)
+		return err
+	}
+	device := ensink.Device{
+		DeviceID: record[0],
+		UserID:   record[1],
+		Token:    record[2],
+		Platform: record[3],
+	}
+
+	destinationID, err := imp.destinations.ForPlatform(device.Platform)
+	if err == nil {
+		err = imp.client.RegisterDevice(ctx, destinationID, device)
+	}
+	switch {
+	case err == nil:
+		fmt.Println("Registered Device with DeviceID", device.DeviceID)
+		imp.completed(record, record[:1])
+	case errors.Is(err, ensink.ErrConflict):
+		fmt.Println("Device already registered with DeviceID", device.DeviceID)
+		imp.completed(record, record[:1])
+	case ctx.Err() != nil, errors.Is(err, iam.ErrCredentialsInvalid):
+		// The row is left for --resume.
+	default:
+		fmt.Println("Failed Device with DeviceID", device.DeviceID, "after", ensink.Attempts(err), "attempts:", err)
+		imp.failed(record, destinationID, err)
+	}
+	return err
+}
+
+// postSubscription subscribes a subscription.csv record, tag name and device
+// ID, on the destination of the platform of the device.
+func (imp *importer) postSubscription(ctx context.Context, record []string) error {
+	if err := imp.subscriptions().checkFields(record); err != nil {
+		fmt.Println("Failed Subscription row", record, err)
+		imp.failed(record, "", err)
+		return err
+	}
+	tagName, deviceID := record[0], record[1]
+
+	destinationID, err := imp.platforms.destination(imp.destinations, deviceID)
+	if err == nil {
+		err = imp.client.SubscribeTag(ctx, destinationID, deviceID, tagName)
+	}
+	switch {
+	case err == nil:
+		fmt.Println("Registered Subscription with DeviceID", deviceID, tagName)
+		imp.completed(record, record[:2])
+	case errors.Is(err, ensink.ErrConflict):
+		fmt.Println("Subscription already exists with DeviceID", deviceID, tagName)
+		imp.completed(record, record[:2])
+	case ctx.Err() != nil, errors.Is(err, iam.ErrCredentialsInvalid):
+	default:
+		fmt.Println("Failed Subscription with DeviceID", deviceID, tagName, "after", ensink.Attempts(err), "attempts:", err)
+		imp.failed(record, destinationID, err)
+	}
+	return err
+}
@@ -0,0 +1,164 @@
+/**
+ * (C) Copyright IBM Corp. 2022.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Event-Notifications/push-en-migration-tool/deadletter"
+	"github.com/Event-Notifications/push-en-migration-tool/ensink"
+	"github.com/Event-Notifications/push-en-migration-tool/throttle"
+)
+
+// testImport is an import of devices whose rows are posted to nowhere.
+type testImport struct {
+	imp    *importer
+	target importTarget
+	opts   importOptions
+
+	mu     sync.Mutex
+	posted []string
+	// fail holds the device IDs whose rows fail when posted.
+	fail map[string]bool
+}
+
+func newTestImport(t *testing.T) *testImport {
+	dir := t.TempDir()
+	ti := &testImport{
+		imp: &importer{
+			pool:    poolOptions{Workers: 2, MaxWorkers: 2, MaxFailures: failureThreshold{value: 100, percent: true}},
+			limiter: throttle.NewLimiter(2),
+		},
+		opts: importOptions{Journal: filepath.Join(dir, "devices.journal")},
+	}
+	ti.target = ti.imp.devices()
+	ti.target.failedFile = filepath.Join(dir, "failed_devices.jsonl")
+	ti.target.succFile = filepath.Join(dir, "migrated_devices.csv")
+	ti.target.post = func(ctx context.Context, record []string) error {
+		if err := ti.target.checkFields(record); err != nil {
+			ti.imp.failed(record, "", err)
+			return err
+		}
+		ti.mu.Lock()
+		ti.posted = append(ti.posted, record[0])
+		ti.mu.Unlock()
+		if ti.fail[record[0]] {
+			err := &ensink.APIError{StatusCode: 503}
+			ti.imp.failed(record, "", err)
+			return err
+		}
+		ti.imp.completed(record, record[:1])
+		return nil
+	}
+	return ti
+}
+
+func (ti *testImport) run(t *testing.T, input string) error {
+	t.Helper()
+	return ti.imp.run(context.Background(), ti.opts, ti.target, csvRecords(strings.NewReader(input)))
+}
+
+func readDeadLetters(t *testing.T, path string) []deadletter.Entry {
+	t.Helper()
+	r, err := deadletter.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	var entries []deadletter.Entry
+	for {
+		e, err := r.Next()
+		if err != nil {
+			return entries
+		}
+		entries = append(entries, e)
+	}
+}
+
+func TestImportSkipsUnparsableRows(t *testing.T) {
+	ti := newTestImport(t)
+	input := "d1,u,t,A\nd2,u,t,G\nd9\"9,u,t,A\nd3,u,t,A\nd4\nd5,u,t,G\n"
+	if err := ti.run(t, input); err != nil {
+		t.Fatal(err)
+	}
+
+	slices.Sort(ti.posted)
+	if want := []string{"d1", "d2", "d3", "d5"}; !slices.Equal(ti.posted, want) {
+		t.Errorf("posted %v, want %v", ti.posted, want)
+	}
+	entries := readDeadLetters(t, ti.target.failedFile)
+	if len(entries) != 2 {
+		t.Fatalf("got %d dead letters, want 2: %+v", len(entries), entries)
+	}
+	for _, e := range entries {
+		if e.Category != string(ensink.CategoryValidation) || e.Retriable {
+			t.Errorf("dead letter %+v is not a permanent validation failure", e)
+		}
+	}
+	if !slices.ContainsFunc(entries, func(e deadletter.Entry) bool { return strings.Contains(e.Error, "line 3") }) {
+		t.Errorf("no dead letter names line 3: %+v", entries)
+	}
+}
+
+func TestReadDevicesSkipsUnparsableRows(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "devices.csv")
+	if err := os.WriteFile(path, []byte("d1,u,t,A\nd9\"9,u,t,A\nd2\nd3,u,t,G\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []string
+	malformed := 0
+	err := readDevices(path, func(deviceID, platform string) { ids = append(ids, deviceID) }, &malformed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"d1", "d3"}; !slices.Equal(ids, want) {
+		t.Errorf("read %v, want %v", ids, want)
+	}
+	if malformed != 2 {
+		t.Errorf("malformed = %d, want 2", malformed)
+	}
+}
+
+func TestImportResumeSkipsJournaledRows(t *testing.T) {
+	ti := newTestImport(t)
+	if err := ti.run(t, "d1,u,t,A\nd2,u,t,G\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	ti.posted = nil
+	ti.opts.Resume = true
+	if err := ti.run(t, "d1,u,t,A\nd2,u,t,G\nd3,u,t,A\n"); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"d3"}; !slices.Equal(ti.posted, want) {
+		t.Errorf("posted %v on resume, want %v", ti.posted, want)
+	}
+	succ, err := os.ReadFile(ti.target.succFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Count(string(succ), "\n"); got != 3 {
+		t.Errorf("success file has %d rows, want 3:\n%s", got, succ)
+	}
+}
@@ -0,0 +1,141 @@
+/**
+ * (C) Copyright IBM Corp. 2022.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Command push-en-migrate migrates devices and tag subscriptions from an
+// IBM Push Notifications instance to an IBM Event Notifications instance.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+const usage = `Usage: push-en-migrate <command> [flags]
+
+Commands:
+  export devices          Export Push devices to devices.csv
+  export subscriptions    Export Push subscriptions to subscription.csv
+  import devices          Register exported devices on the EN destinations
+  import subscriptions    Subscribe exported devices to their tags in EN
+  migrate all             Run both exports followed by both imports, or with
+                          --direct import devices and subscriptions as they
+                          are read from Push
+  retry-failed            Import the retriable rows of failed_devices.jsonl
+                          and failed_subscription.jsonl again
+  pause                   Pause a running import started with
+                          --control-socket after its requests in flight
+  resume                  Resume a paused import
+  status                  Show the progress and workers of a running import
+  set-workers <n>         Change the number of workers of a running import
+  preflight               Check both instances, credentials and destinations
+                          before migrating
+  config validate         Check the profiles of the configuration file
+  keystore set <name>     Store the secret read from standard input in the
+                          encrypted keystore
+  keystore delete <name>  Remove a secret from the keystore
+  keystore list           List the names of the secrets in the keystore
+
+Run "push-en-migrate <command> -h" for the flags of a command.
+`
+
+var errUsage = errors.New("invalid usage")
+
+// commands maps a command line, one or two words long, to its handler.
+var commands = map[string]func(args []string) error{
+	"export devices":       runExportDevices,
+	"export subscriptions": runExportSubscriptions,
+	"import devices":       runImportDevices,
+	"import subscriptions": runImportSubscriptions,
+	"migrate all":          runMigrateAll,
+	"migrate":              runMigrateAll,
+	"retry-failed":         runRetryFailed,
+	"pause":                runPause,
+	"resume":               runResume,
+	"status":               runStatus,
+	"set-workers":          runSetWorkers,
+	"preflight":            runPreflight,
+	"config validate":      runConfigValidate,
+	"keystore set":         runKeystoreSet,
+	"keystore delete":      runKeystoreDelete,
+	"keystore list":        runKeystoreList,
+}
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		if errors.Is(err, errUsage) {
+			if err != errUsage {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+			}
+			fmt.Fprint(os.Stderr, usage)
+			os.Exit(2)
+		}
+		if interrupted(err) && resumable(os.Args[1:]) {
+			fmt.Fprintln(os.Stderr, "Stopped before finishing. Run the following to continue:")
+			fmt.Fprintln(os.Stderr, "  ", resumeCommand(os.Args[1:]))
+			os.Exit(130)
+		}
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
+
+// resumableCommands are the commands that continue where an interrupted
+// run stopped.
+var resumableCommands = []string{
+	"export devices", "export subscriptions", "import devices", "import subscriptions",
+	"migrate all", "migrate", "retry-failed",
+}
+
+// resumable reports whether the command args can be resumed.
+func resumable(args []string) bool {
+	return len(args) >= 2 && slices.Contains(resumableCommands, args[0]+" "+args[1]) ||
+		len(args) >= 1 && slices.Contains(resumableCommands, args[0])
+}
+
+// resumeCommand returns the command line that continues the interrupted
+// command args. retry-failed always continues an interrupted retry.
+func resumeCommand(args []string) string {
+	line := append([]string{"push-en-migrate"}, args...)
+	resumed := slices.ContainsFunc(args, func(arg string) bool {
+		return arg == "-resume" || arg == "--resume" || strings.HasPrefix(arg, "-resume=") || strings.HasPrefix(arg, "--resume=")
+	})
+	if !resumed && args[0] != "retry-failed" {
+		line = append(line, "--resume")
+	}
+	return strings.Join(line, " ")
+}
+
+func run(args []string) error {
+	if len(args) >= 2 {
+		if cmd, ok := commands[args[0]+" "+args[1]]; ok {
+			return cmd(args[2:])
+		}
+	}
+	if len(args) >= 1 {
+		if cmd, ok := commands[args[0]]; ok {
+			return cmd(args[1:])
+		}
+		if args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+			fmt.Print(usage)
+			return nil
+		}
+		return fmt.Errorf("%w: unknown command %q", errUsage, strings.Join(args, " "))
+	}
+	return errUsage
+}
@@ -0,0 +1,202 @@
+/**
+ * (C) Copyright IBM Corp. 2022.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Event-Notifications/push-en-migration-tool/pushsource"
+)
+
+func runMigrateAll(args []string) error {
+	fs := flag.NewFlagSet("migrate all", flag.ExitOnError)
+	devicesFile := fs.String("devices-file", "devices.csv", "intermediate devices file")
+	subscriptionsFile := fs.String("subscriptions-file", "subscription.csv", "intermediate subscriptions file")
+	devicesJournal := fs.String("devices-journal", "devices.journal", "journal of the device import")
+	subscriptionsJournal := fs.String("subscriptions-journal", "subscription.journal", "journal of the subscription import")
+	resume := fs.Bool("resume", false, "resume exports from their checkpoints and skip rows completed by a previous import")
+	concurrency := fs.Int("concurrency", 4, "maximum number of pages fetched from Push at once")
+	direct := fs.Bool("direct", false, "register devices and subscriptions as Push pages arrive instead of going through the intermediate files")
+	var pushAuth string
+	registerPushAuth(fs, &pushAuth)
+	tee := fs.Bool("tee", false, "with --direct, also write the rows read from Push to the intermediate files")
+	var pool poolOptions
+	pool.register(fs)
+	s := loadSettings()
+	s.registerPushFlags(fs)
+	s.registerENFlags(fs)
+	cfg := registerConfigFlags(fs)
+	fs.Parse(args)
+	if err := cfg.apply(fs, &s); err != nil {
+		return err
+	}
+	if err := pool.validate(); err != nil {
+		return err
+	}
+
+	ctx, cancel := signalContext(pool.DrainTimeout)
+	defer cancel()
+	stopControl, err := pool.serveControl()
+	if err != nil {
+		return err
+	}
+	defer stopControl()
+
+	if *direct {
+		opts := directOptions{
+			Resume:               *resume,
+			Pool:                 pool,
+			PushAuth:             pushAuth,
+			DevicesJournal:       *devicesJournal,
+			SubscriptionsJournal: *subscriptionsJournal,
+		}
+		if *tee {
+			opts.DevicesFile = *devicesFile
+			opts.SubscriptionsFile = *subscriptionsFile
+		}
+		return migrateDirect(ctx, s, opts)
+	}
+
+	steps := []struct {
+		name string
+		run  func() error
+	}{
+		{"export devices", func() error {
+			return exportDevices(ctx, s, exportOptions{Output: *devicesFile, Resume: *resume, Concurrency: *concurrency, PushAuth: pushAuth})
+		}},
+		{"export subscriptions", func() error {
+			return exportSubscriptions(ctx, s, exportOptions{Output: *subscriptionsFile, Resume: *resume, Concurrency: *concurrency, PushAuth: pushAuth})
+		}},
+		{"import devices", func() error {
+			return importDevices(ctx, s, importOptions{Input: *devicesFile, Journal: *devicesJournal, Resume: *resume, Pool: pool})
+		}},
+		{"import subscriptions", func() error {
+			return importSubscriptions(ctx, s, importOptions{Input: *subscriptionsFile, Journal: *subscriptionsJournal, Resume: *resume, Pool: pool, DevicesFile: *devicesFile})
+		}},
+	}
+	for _, step := range steps {
+		fmt.Println("Running", step.name)
+		if err := step.run(); err != nil {
+			return fmt.Errorf("%s: %w", step.name, err)
+		}
+	}
+	return nil
+}
+
+// directOptions configure a migration that skips the intermediate files.
+type directOptions struct {
+	Resume   bool
+	Pool     poolOptions
+	PushAuth string
+	// DevicesJournal and SubscriptionsJournal record the completed rows.
+	DevicesJournal       string
+	SubscriptionsJournal string
+	// DevicesFile and SubscriptionsFile, when set, receive a copy of the
+	// rows read from Push.
+	DevicesFile       string
+	SubscriptionsFile string
+}
+
+// migrateDirect feeds the Push device and subscription iterators straight
+// into the EN import workers, so each page is imported as soon as it is
+// read.
+func migrateDirect(ctx context.Context, s settings, opts directOptions) error {
+	client, err := newPushClient(s, opts.PushAuth)
+	if err != nil {
+		return err
+	}
+	imp, err := newImporter(ctx, s, opts.Pool)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Running direct migration of devices")
+	imp.platforms = newDevicePlatforms("the devices read from Push")
+	devices := client.Devices(ctx)
+	next := func() ([]string, error) {
+		if devices.Next() {
+			device := devices.Device()
+			imp.platforms.add(device.DeviceID, device.Platform)
+			return deviceRecord(device), nil
+		}
+		if err := devices.Err(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+	err = withTee(opts.DevicesFile, next, func(next func() ([]string, error)) error {
+		return imp.run(ctx, importOptions{Journal: opts.DevicesJournal, Resume: opts.Resume}, imp.devices(), next)
+	})
+	if err != nil {
+		return fmt.Errorf("migrate devices: %w", err)
+	}
+
+	fmt.Println("Running direct migration of subscriptions")
+	subs := client.Subscriptions(ctx)
+	next = func() ([]string, error) {
+		for subs.Next() {
+			if sub := subs.Subscription(); sub.TagName != pushsource.BroadcastTag {
+				return subscriptionRecord(sub), nil
+			}
+		}
+		if err := subs.Err(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+	err = withTee(opts.SubscriptionsFile, next, func(next func() ([]string, error)) error {
+		return imp.run(ctx, importOptions{Journal: opts.SubscriptionsJournal, Resume: opts.Resume}, imp.subscriptions(), next)
+	})
+	if err != nil {
+		return fmt.Errorf("migrate subscriptions: %w", err)
+	}
+	return nil
+}
+
+// withTee calls run with next, copying every record it returns to the CSV
+// file path. An empty path disables the copy.
+func withTee(path string, next func() ([]string, error), run func(next func() ([]string, error)) error) error {
+	if path == "" {
+		return run(next)
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	csvwriter := csv.NewWriter(file)
+
+	err = run(func() ([]string, error) {
+		record, err := next()
+		if err == nil {
+			err = csvwriter.Write(record)
+		}
+		return record, err
+	})
+
+	csvwriter.Flush()
+	if err != nil {
+		return err
+	}
+	return csvwriter.Error()
+}
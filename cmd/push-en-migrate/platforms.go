@@ -0,0 +1,208 @@
+/**
+ * (C) Copyright IBM Corp. 2022.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"hash/maphash"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/Event-Notifications/push-en-migration-tool/ensink"
+)
+
+// Platforms of devices as stored by devicePlatforms.
+const (
+	platformOther byte = iota + 1
+	platformAPNs
+	platformFCM
+	// platformAmbiguous marks a hash shared by devices of different
+	// platforms, which are then looked up by ID.
+	platformAmbiguous
+)
+
+// devicePlatforms maps device IDs to their Push platform, so that a
+// subscription is only made on the destination of its device. To keep the
+// map small for large instances it holds a 64-bit hash of each device ID
+// and a byte for its platform, under 40 bytes per device. Devices whose
+// hashes collide are kept by ID.
+type devicePlatforms struct {
+	// source names where the devices come from in errors.
+	source string
+	seed   maphash.Seed
+
+	mu        sync.RWMutex
+	platforms map[uint64]byte
+	byID      map[string]byte
+	n         int
+}
+
+func newDevicePlatforms(source string) *devicePlatforms {
+	return &devicePlatforms{
+		source:    source,
+		seed:      maphash.MakeSeed(),
+		platforms: make(map[uint64]byte),
+		byID:      make(map[string]byte),
+	}
+}
+
+// loadDevicePlatforms reads the platforms of the devices exported to path.
+// The devices of colliding hashes are read again to be kept by ID.
+func loadDevicePlatforms(path string) (*devicePlatforms, error) {
+	p := newDevicePlatforms(path)
+	malformed := 0
+	err := readDevices(path, func(deviceID, platform string) {
+		p.add(deviceID, platform)
+	}, &malformed)
+	if err != nil {
+		return nil, err
+	}
+	if p.len() == 0 && malformed > 0 {
+		return nil, fmt.Errorf("%s is not an export of devices, want device ID, user ID, token and platform", path)
+	}
+	if p.ambiguous() {
+		err := readDevices(path, p.resolve, new(int))
+		if err != nil {
+			return nil, err
+		}
+	}
+	fmt.Println("Loaded the platforms of", p.len(), "devices from", path)
+	if malformed > 0 {
+		fmt.Println("Skipped", malformed, "malformed rows of", path)
+	}
+	return p, nil
+}
+
+// readDevices calls fn with the ID and platform of every device exported to
+// path, counting the rows that cannot be parsed or are too short to have
+// them in malformed.
+func readDevices(path string, fn func(deviceID, platform string), malformed *int) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("the exported devices are needed to subscribe each device on its own destination: %w", err)
+	}
+	defer file.Close()
+
+	next := csvRecords(file)
+	for {
+		record, err := next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if errors.Is(err, ensink.ErrInvalidRow) {
+			*malformed++
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		// Malformed rows are failures of the device import, and their
+		// subscriptions fail as unknown devices.
+		if len(record) < 4 {
+			*malformed++
+			continue
+		}
+		fn(record[0], record[3])
+	}
+}
+
+func platformCode(platform string) byte {
+	switch platform {
+	case ensink.PlatformAPNs:
+		return platformAPNs
+	case ensink.PlatformFCM:
+		return platformFCM
+	}
+	return platformOther
+}
+
+// add records the platform of deviceID. A later platform for the same
+// device replaces the earlier one.
+func (p *devicePlatforms) add(deviceID, platform string) {
+	h := maphash.String(p.seed, deviceID)
+	code := platformCode(platform)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.n++
+	switch old, ok := p.platforms[h]; {
+	case !ok:
+		p.platforms[h] = code
+	case old == code:
+		// Either the same device again or one of the same platform,
+		// which needs no other entry.
+	default:
+		p.platforms[h] = platformAmbiguous
+		p.byID[strings.Clone(deviceID)] = code
+	}
+}
+
+// ambiguous reports whether some devices can only be told apart by ID.
+func (p *devicePlatforms) ambiguous() bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return len(p.byID) > 0
+}
+
+// resolve keeps deviceID by ID if its hash is ambiguous and it is not kept
+// already, which is the case of the first of the devices sharing it.
+func (p *devicePlatforms) resolve(deviceID, platform string) {
+	h := maphash.String(p.seed, deviceID)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.platforms[h] != platformAmbiguous {
+		return
+	}
+	if _, ok := p.byID[deviceID]; !ok {
+		p.byID[strings.Clone(deviceID)] = platformCode(platform)
+	}
+}
+
+// destination returns the destination of the device deviceID.
+func (p *devicePlatforms) destination(d ensink.Destinations, deviceID string) (string, error) {
+	p.mu.RLock()
+	code := p.platforms[maphash.String(p.seed, deviceID)]
+	ambiguous := code == platformAmbiguous
+	if ambiguous {
+		code = p.byID[deviceID]
+	}
+	p.mu.RUnlock()
+
+	switch {
+	case code == platformAPNs:
+		return d.ForPlatform(ensink.PlatformAPNs)
+	case code == platformFCM:
+		return d.ForPlatform(ensink.PlatformFCM)
+	case code == platformOther:
+		return "", fmt.Errorf("%w: device %s has a platform other than %s and %s in %s",
+			ensink.ErrUnknownPlatform, deviceID, ensink.PlatformAPNs, ensink.PlatformFCM, p.source)
+	case ambiguous:
+		return "", fmt.Errorf("%w: the platform of device %s is ambiguous in %s, import subscriptions from the exported files instead",
+			ensink.ErrUnknownPlatform, deviceID, p.source)
+	}
+	return "", fmt.Errorf("%w: device %s is not in %s", ensink.ErrUnknownPlatform, deviceID, p.source)
+}
+
+// len returns the number of devices added.
+func (p *devicePlatforms) len() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.n
+}
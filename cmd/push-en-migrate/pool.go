@@ -0,0 +1,306 @@
+/**
+ * (C) Copyright IBM Corp. 2022.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Event-Notifications/push-en-migration-tool/ensink"
+	"github.com/Event-Notifications/push-en-migration-tool/throttle"
+)
+
+// poolOptions configure the workers posting to EN, how their requests are
+// limited and retried, and how many failed rows are tolerated.
+type poolOptions struct {
+	Workers       int
+	Adaptive      bool
+	MaxWorkers    int
+	TargetLatency time.Duration
+	// Rate and Burst limit the requests per second to the EN instance. A
+	// zero Rate disables the limit.
+	Rate  float64
+	Burst int
+	Retry ensink.RetryPolicy
+	// MaxFailures is the number of failed rows tolerated by an import.
+	MaxFailures failureThreshold
+	// DrainTimeout is how long requests in flight may take to finish
+	// once the import is asked to stop.
+	DrainTimeout time.Duration
+	// ControlSocket, if set, is the path of the Unix socket on which the
+	// import accepts pause, resume, status and set-workers commands.
+	ControlSocket string
+
+	control *controller
+}
+
+func (o *poolOptions) register(fs *flag.FlagSet) {
+	fs.IntVar(&o.Workers, "workers", 15, "number of concurrent EN requests, or the starting number with --adaptive")
+	fs.BoolVar(&o.Adaptive, "adaptive", false, "grow the number of workers while EN is healthy and halve it on 429 and 5xx responses")
+	fs.IntVar(&o.MaxWorkers, "max-workers", 100, "maximum number of workers with --adaptive or set-workers")
+	fs.DurationVar(&o.TargetLatency, "target-latency", 2*time.Second, "average EN latency above which --adaptive stops adding workers")
+	fs.Float64Var(&o.Rate, "rate", 0, "maximum EN requests per second for the instance, 0 for no limit")
+	fs.IntVar(&o.Burst, "burst", 10, "number of EN requests that may exceed --rate in a burst")
+	fs.IntVar(&o.Retry.MaxAttempts, "max-attempts", ensink.DefaultRetryPolicy.MaxAttempts, "number of times an EN request failing with a network error, 429 or 5xx is tried")
+	fs.DurationVar(&o.Retry.BaseDelay, "retry-base-delay", ensink.DefaultRetryPolicy.BaseDelay, "backoff before the first retry, doubled on every further retry")
+	fs.DurationVar(&o.Retry.MaxDelay, "retry-max-delay", ensink.DefaultRetryPolicy.MaxDelay, "maximum backoff between retries")
+	fs.StringVar(&o.ControlSocket, "control-socket", "", "Unix socket accepting the pause, resume, status and set-workers commands")
+	fs.DurationVar(&o.DrainTimeout, "drain-timeout", 30*time.Second, "time given to requests in flight to finish after SIGINT or SIGTERM")
+	fs.Var(&o.MaxFailures, "max-failures", "number of failed rows, or percentage of rows with a trailing %, tolerated before exiting with an error")
+}
+
+// validate rejects worker counts the pool cannot run with. It must be
+// called after the flags are parsed.
+func (o *poolOptions) validate() error {
+	if o.Workers < 1 {
+		return fmt.Errorf("%w: --workers must be at least 1, got %d", errUsage, o.Workers)
+	}
+	if o.MaxWorkers < 1 {
+		return fmt.Errorf("%w: --max-workers must be at least 1, got %d", errUsage, o.MaxWorkers)
+	}
+	return nil
+}
+
+var (
+	bucketsMu sync.Mutex
+	buckets   = map[string]*throttle.TokenBucket{}
+)
+
+// rateLimiter returns the token bucket of the EN instance instanceID, or nil
+// if the rate is not limited. Every importer of the process writing to the
+// same instance shares its bucket, so devices and subscriptions migrated
+// together stay within one quota.
+func (o poolOptions) rateLimiter(instanceID string) *throttle.TokenBucket {
+	if o.Rate <= 0 {
+		return nil
+	}
+	bucketsMu.Lock()
+	defer bucketsMu.Unlock()
+	b, ok := buckets[instanceID]
+	if !ok {
+		b = throttle.NewTokenBucket(o.Rate, o.Burst)
+		buckets[instanceID] = b
+	}
+	return b
+}
+
+// goroutines returns the number of workers to start, enough for the
+// largest limit the pool may reach.
+func (o poolOptions) goroutines() int {
+	if o.Adaptive || o.ControlSocket != "" {
+		return max(o.Workers, o.MaxWorkers)
+	}
+	return o.Workers
+}
+
+type postFunc func(ctx context.Context, record []string) error
+
+// streamInputs sends the records returned by next that skip does not match
+// on the returned channel, one at a time, so that only the records being
+// posted are held in memory. It stops at io.EOF, or early when ctx is done
+// or its command is asked to stop. Any other error from next is delivered
+// on the second channel once the first is closed.
+func streamInputs(ctx context.Context, next func() ([]string, error), skip func([]string) bool) (<-chan []string, <-chan error) {
+	inputCh := make(chan []string)
+	errCh := make(chan error, 1)
+	go func() {
+		defer close(errCh)
+		defer close(inputCh)
+		for !stopped(ctx) {
+			input, err := next()
+			if errors.Is(err, io.EOF) {
+				return
+			}
+			if err != nil {
+				errCh <- err
+				return
+			}
+			if skip(input) {
+				continue
+			}
+			select {
+			case inputCh <- input:
+			case <-stopping(ctx):
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return inputCh, errCh
+}
+
+// AsyncHTTP posts every record received on inputCh with the given number
+// of workers and counts the outcomes in sum. A failed row does not stop the
+// others; only the cancellation of ctx does, in which case its error is
+// returned. A worker only takes a record once limiter lets it start, so the
+// limiter decides how many of the workers are active. Workers still waiting
+// on the limiter give up when the command of ctx is asked to stop, so a
+// paused import stops without waiting for the drain timeout.
+func AsyncHTTP(ctx context.Context, inputCh <-chan []string, post postFunc, workers int, limiter *throttle.Limiter, sum *summary) error {
+	var wg sync.WaitGroup
+
+	wg.Add(workers)
+
+	acquireCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-stopping(ctx):
+			cancel()
+		case <-acquireCtx.Done():
+		}
+	}()
+
+	resultCh := make(chan error)
+
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for {
+				if err := limiter.Acquire(acquireCtx); err != nil {
+					return
+				}
+				input, ok := <-inputCh
+				if !ok {
+					limiter.Release()
+					return
+				}
+				err := post(ctx, input)
+				limiter.Release()
+				resultCh <- err
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(resultCh)
+	}()
+
+	for err := range resultCh {
+		if err != nil && ctx.Err() != nil {
+			// Interrupted rows are neither migrated nor failed.
+			continue
+		}
+		sum.add(err)
+	}
+
+	return ctx.Err()
+}
+
+// summary counts the outcome of the rows of an import. It may be read with
+// counts while the import runs.
+type summary struct {
+	mu       sync.Mutex
+	Migrated int
+	Existing int
+	Failed   map[ensink.Category]int
+}
+
+func newSummary() *summary {
+	return &summary{Failed: make(map[ensink.Category]int)}
+}
+
+// add counts a row posted with the result err.
+func (s *summary) add(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case err == nil:
+		s.Migrated++
+	case errors.Is(err, ensink.ErrConflict):
+		s.Existing++
+	default:
+		s.Failed[ensink.Classify(err)]++
+	}
+}
+
+// counts returns the number of rows migrated, already existing and failed
+// so far.
+func (s *summary) counts() (migrated, existing, failed int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Migrated, s.Existing, s.failures()
+}
+
+// failures returns the number of failed rows.
+func (s *summary) failures() int {
+	n := 0
+	for _, count := range s.Failed {
+		n += count
+	}
+	return n
+}
+
+// total returns the number of rows posted.
+func (s *summary) total() int {
+	return s.Migrated + s.Existing + s.failures()
+}
+
+func (s *summary) print(w io.Writer) {
+	fmt.Fprintf(w, "Summary: %d rows, %d migrated, %d already existed, %d failed\n",
+		s.total(), s.Migrated, s.Existing, s.failures())
+	for _, category := range ensink.Categories {
+		if count := s.Failed[category]; count > 0 {
+			fmt.Fprintf(w, "  %-10s %d\n", category, count)
+		}
+	}
+}
+
+// failureThreshold is the number, or with a trailing "%" the percentage, of
+// failed rows an import tolerates before it exits with an error.
+type failureThreshold struct {
+	value   float64
+	percent bool
+}
+
+func (t *failureThreshold) String() string {
+	if t.percent {
+		return strconv.FormatFloat(t.value, 'f', -1, 64) + "%"
+	}
+	return strconv.FormatFloat(t.value, 'f', -1, 64)
+}
+
+func (t *failureThreshold) Set(v string) error {
+	number, percent := strings.CutSuffix(v, "%")
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil || value < 0 {
+		return fmt.Errorf("invalid threshold %q, want a count such as 100 or a percentage such as 0.5%%", v)
+	}
+	if !percent && value != float64(int(value)) {
+		return fmt.Errorf("invalid threshold %q, a count must be a whole number", v)
+	}
+	t.value, t.percent = value, percent
+	return nil
+}
+
+// exceeded reports whether the failures of s are above the threshold.
+func (t failureThreshold) exceeded(s *summary) bool {
+	failures := float64(s.failures())
+	if t.percent {
+		return s.total() > 0 && failures*100/float64(s.total()) > t.value
+	}
+	return failures > t.value
+}
@@ -0,0 +1,315 @@
+/**
+ * (C) Copyright IBM Corp. 2022.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Event-Notifications/push-en-migration-tool/ensink"
+	"github.com/Event-Notifications/push-en-migration-tool/iam"
+	"github.com/Event-Notifications/push-en-migration-tool/pushsource"
+)
+
+// preflight runs the checks of the preflight command and prints a line for
+// each of them.
+type preflight struct {
+	timeout                 time.Duration
+	passed, failed, skipped int
+}
+
+// check runs a check with the timeout and reports whether it passed. run
+// returns a detail printed on success.
+func (p *preflight) check(ctx context.Context, name string, run func(ctx context.Context) (string, error)) bool {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	detail, err := run(ctx)
+	if err != nil {
+		p.failed++
+		fmt.Printf("  [FAIL] %s: %s\n", name, explain(err))
+		return false
+	}
+	p.passed++
+	if detail != "" {
+		name += ": " + detail
+	}
+	fmt.Printf("  [ ok ] %s\n", name)
+	return true
+}
+
+// skip records a check that cannot run because another one failed.
+func (p *preflight) skip(name, reason string) {
+	p.skipped++
+	fmt.Printf("  [skip] %s: %s\n", name, reason)
+}
+
+// explain describes the failure of a check in terms of what to fix.
+func explain(err error) string {
+	status := 0
+	var enErr *ensink.APIError
+	var pushErr *pushsource.APIError
+	switch {
+	case errors.As(err, &enErr):
+		status = enErr.StatusCode
+	case errors.As(err, &pushErr):
+		status = pushErr.StatusCode
+	}
+
+	switch {
+	case errors.Is(err, iam.ErrCredentialsInvalid):
+		return "the credentials were rejected, check the API key or trusted profile: " + err.Error()
+	case status == http.StatusForbidden:
+		return "access denied, the credentials need a service role such as Writer on the instance: " + err.Error()
+	case status == http.StatusNotFound:
+		return "not found, check the ID and region: " + err.Error()
+	case errors.Is(err, context.DeadlineExceeded):
+		return "no answer in time, check the region, endpoint and network: " + err.Error()
+	}
+	return err.Error()
+}
+
+// runPreflight checks both instances before a migration: that tokens are
+// issued on both sides, the Push app and EN instance exist, the destinations
+// exist with the types of their platforms, and the EN credentials may write
+// to them. Nothing is migrated.
+func runPreflight(args []string) error {
+	fs := flag.NewFlagSet("preflight", flag.ExitOnError)
+	var pushAuth string
+	registerPushAuth(fs, &pushAuth)
+	timeout := fs.Duration("timeout", 30*time.Second, "time allowed for each check")
+	s := loadSettings()
+	s.registerPushFlags(fs)
+	s.registerENFlags(fs)
+	cfg := registerConfigFlags(fs)
+	fs.Parse(args)
+	if err := cfg.apply(fs, &s); err != nil {
+		return err
+	}
+
+	// Nothing is left to finish when preflight is interrupted.
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	p := &preflight{timeout: *timeout}
+
+	fmt.Println("Push Notifications")
+	p.checkPush(ctx, s, pushAuth)
+	if ctx.Err() == nil {
+		fmt.Println("Event Notifications")
+		p.checkEN(ctx, s)
+	}
+	if ctx.Err() != nil {
+		return errors.New("preflight interrupted before all checks ran")
+	}
+
+	total := p.passed + p.failed + p.skipped
+	if p.failed > 0 {
+		fmt.Printf("NO-GO: %d of %d checks failed and %d skipped\n", p.failed, total, p.skipped)
+		return errors.New("preflight failed, fix the problems above in setEnv.sh or the configuration profile and run it again")
+	}
+	fmt.Printf("GO: all %d checks passed\n", total)
+	return nil
+}
+
+// sideSettings checks the settings of one side, those of missingSettings
+// for the pushAuth mode starting with prefix. The destinations are checked
+// on their own.
+func (p *preflight) sideSettings(ctx context.Context, s settings, pushAuth, prefix string) bool {
+	return p.check(ctx, "settings", func(context.Context) (string, error) {
+		var missing []string
+		for _, m := range missingSettings(s, pushAuth) {
+			if strings.HasPrefix(m, prefix) && !strings.Contains(m, "_destination_id") {
+				missing = append(missing, m)
+			}
+		}
+		if len(missing) > 0 {
+			return "", errors.New("missing " + strings.Join(missing, ", "))
+		}
+		return "", nil
+	})
+}
+
+func (p *preflight) checkPush(ctx context.Context, s settings, pushAuth string) {
+	if !p.sideSettings(ctx, s, pushAuth, "push.") {
+		p.skip("credentials", "incomplete settings")
+		p.skip("app "+s.PushInstanceID, "incomplete settings")
+		return
+	}
+
+	var client *pushsource.Client
+	ok := p.check(ctx, "credentials", func(ctx context.Context) (string, error) {
+		var err error
+		if client, err = newPushClient(s, pushAuth); err != nil {
+			return "", err
+		}
+		if pushAuth != pushAuthIAM {
+			return "using --push-auth " + pushAuth, nil
+		}
+		creds, err := s.pushCredentials()
+		if err != nil {
+			return "", err
+		}
+		if _, err := authenticator(creds).Token(ctx); err != nil {
+			return "", err
+		}
+		return "IAM token issued", nil
+	})
+	if !ok {
+		p.skip("app "+s.PushInstanceID, "no credentials")
+		return
+	}
+
+	client.PageSize = 1
+	p.check(ctx, "app "+s.PushInstanceID, func(ctx context.Context) (string, error) {
+		devices, err := client.GetDevicePage(ctx, client.DevicesURL(0))
+		if err != nil {
+			return "", err
+		}
+		subscriptions, err := client.GetSubscriptionPage(ctx, client.SubscriptionsURL(0))
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%d devices and %d subscriptions to export",
+			devices.PageInfo.TotalCount, subscriptions.PageInfo.TotalCount), nil
+	})
+}
+
+func (p *preflight) checkEN(ctx context.Context, s settings) {
+	destinations := []struct {
+		name, env, id, typ string
+	}{
+		{"iOS destination", "EN_IOS_DESTINATION_ID", s.ENIOSDestinationID, ensink.DestinationTypeIOS},
+		{"Android destination", "EN_ANDROID_DESTINATION_ID", s.ENAndroidDestinationID, ensink.DestinationTypeAndroid},
+	}
+	for i := range destinations {
+		if destinations[i].id != "" {
+			destinations[i].name += " " + destinations[i].id
+		}
+	}
+	skipRest := func(from int, reason string) {
+		names := []string{"credentials", "instance " + s.ENInstanceID}
+		for _, d := range destinations {
+			names = append(names, d.name)
+		}
+		for _, d := range destinations {
+			names = append(names, "write permission on "+d.name)
+		}
+		for _, name := range names[from:] {
+			p.skip(name, reason)
+		}
+	}
+
+	// The Push settings are left out, whatever their mode.
+	if !p.sideSettings(ctx, s, pushAuthIAM, "en.") {
+		skipRest(0, "incomplete settings")
+		return
+	}
+
+	var client *ensink.Client
+	ok := p.check(ctx, "credentials", func(ctx context.Context) (string, error) {
+		enurl, err := enURL(s.ENRegion, s.ENEndpoint)
+		if err != nil {
+			return "", err
+		}
+		creds, err := s.enCredentials()
+		if err != nil {
+			return "", err
+		}
+		auth := authenticator(creds)
+		if _, err := auth.Token(ctx); err != nil {
+			return "", err
+		}
+		client = ensink.NewClient(enurl, s.ENInstanceID, auth)
+		// Report failures instead of waiting out the backoff.
+		client.Retry = ensink.RetryPolicy{MaxAttempts: 1}
+		return "IAM token issued", nil
+	})
+	if !ok {
+		skipRest(1, "no credentials")
+		return
+	}
+
+	var all []ensink.Destination
+	ok = p.check(ctx, "instance "+s.ENInstanceID, func(ctx context.Context) (string, error) {
+		list, err := client.ListDestinations(ctx, 100)
+		if err != nil {
+			return "", err
+		}
+		all = list.Destinations
+		return fmt.Sprintf("%d destinations", list.TotalCount), nil
+	})
+	if !ok {
+		skipRest(2, "instance not reachable")
+		return
+	}
+
+	var writable []string
+	for _, d := range destinations {
+		ok := p.check(ctx, d.name, func(ctx context.Context) (string, error) {
+			if d.id == "" {
+				return "", fmt.Errorf("%s is not set%s", d.env, candidates(all, d.typ))
+			}
+			got, err := client.GetDestination(ctx, d.id)
+			var apiErr *ensink.APIError
+			if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+				return "", fmt.Errorf("not found in the instance%s", candidates(all, d.typ))
+			}
+			if err != nil {
+				return "", err
+			}
+			if got.Type != d.typ {
+				return "", fmt.Errorf("%s is of type %s, want %s%s", got.Name, got.Type, d.typ, candidates(all, d.typ))
+			}
+			return fmt.Sprintf("%s (%s)", got.Name, got.Type), nil
+		})
+		if ok {
+			writable = append(writable, d.id)
+		}
+	}
+	for _, d := range destinations {
+		name := "write permission on " + d.name
+		if !slices.Contains(writable, d.id) {
+			p.skip(name, "invalid destination")
+			continue
+		}
+		p.check(ctx, name, func(ctx context.Context) (string, error) {
+			return "invalid probe device rejected, so EN authorized the write", client.CheckWrite(ctx, d.id)
+		})
+	}
+}
+
+// candidates lists the destinations of type typ for an error message.
+func candidates(all []ensink.Destination, typ string) string {
+	var found []string
+	for _, d := range all {
+		if d.Type == typ {
+			found = append(found, fmt.Sprintf("%s (%s)", d.ID, d.Name))
+		}
+	}
+	if len(found) == 0 {
+		return ", the instance has no " + typ + " destination"
+	}
+	return ", " + typ + " destinations of the instance: " + strings.Join(found, ", ")
+}
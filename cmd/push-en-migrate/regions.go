@@ -0,0 +1,173 @@
+/**
+ * (C) Copyright IBM Corp. 2022.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/Event-Notifications/push-en-migration-tool/iam"
+)
+
+// region is an IBM Cloud region the instances may be in. A region is named
+// either by its name, such as dallas, or its ID, such as us-south.
+type region struct {
+	name string
+	id   string
+	// test selects the IBM Cloud test environment.
+	test bool
+	// push is set if Push Notifications is offered in the region; Event
+	// Notifications is offered in all of them.
+	push bool
+}
+
+// regions lists every region known to the tool.
+var regions = []region{
+	{name: "stage", id: "us-south", test: true, push: true},
+	{name: "dallas", id: "us-south", push: true},
+	{name: "washington", id: "us-east", push: true},
+	{name: "london", id: "eu-gb", push: true},
+	{name: "frankfurt", id: "eu-de", push: true},
+	{name: "madrid", id: "eu-es"},
+	{name: "sydney", id: "au-syd", push: true},
+	{name: "tokyo", id: "jp-tok", push: true},
+}
+
+// Base paths of the services on their regional hosts.
+const (
+	pushPath = "/imfpush/v1/apps/"
+	enPath   = "/event-notifications/v1/instances/"
+)
+
+// lookupRegion returns the region named name. A "private." prefix, as in
+// private.dallas or private.us-south, selects the private endpoint.
+func lookupRegion(name string) (r region, private, ok bool) {
+	name, private = strings.CutPrefix(strings.ToLower(strings.TrimSpace(name)), "private.")
+	for _, r := range regions {
+		if name == r.name || (name == r.id && !r.test) {
+			return r, private, true
+		}
+	}
+	return region{}, false, false
+}
+
+// regionNames returns the names of the regions, restricted to those
+// offering Push if push is set.
+func regionNames(push bool) string {
+	var names []string
+	for _, r := range regions {
+		if r.push || !push {
+			names = append(names, r.name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+func (r region) domain() string {
+	if r.test {
+		return "test.cloud.ibm.com"
+	}
+	return "cloud.ibm.com"
+}
+
+// pushURL returns the apps endpoint of Push in regionName, or endpoint if
+// it is set.
+func pushURL(regionName, endpoint string) (string, error) {
+	if endpoint != "" {
+		return baseURL(endpoint, pushPath)
+	}
+	r, private, ok := lookupRegion(regionName)
+	switch {
+	case !ok || !r.push:
+		return "", fmt.Errorf("unknown PUSH_INSTANCE_REGION %q, want one of %s, please check setEnv.sh and source it", regionName, regionNames(true))
+	case private:
+		return "", fmt.Errorf("there is no private Push Notifications endpoint, use the public region %s or --push-endpoint", r.name)
+	}
+	return "https://" + r.id + ".imfpush." + r.domain() + pushPath, nil
+}
+
+// enURL returns the instances endpoint of EN in regionName, or endpoint if
+// it is set.
+func enURL(regionName, endpoint string) (string, error) {
+	if endpoint != "" {
+		return baseURL(endpoint, enPath)
+	}
+	r, private, ok := lookupRegion(regionName)
+	if !ok {
+		return "", fmt.Errorf("unknown EN_INSTANCE_REGION %q, want one of %s or private.<region>, please check setEnv.sh and source it", regionName, regionNames(false))
+	}
+	host := r.id + ".event-notifications." + r.domain()
+	if private {
+		host = "private." + host
+	}
+	return "https://" + host + enPath, nil
+}
+
+// baseURL returns the endpoint override endpoint as a base URL ending in
+// "/". A URL without a path, such as http://localhost:8080, gets the
+// default path of the service.
+func baseURL(endpoint, path string) (string, error) {
+	u, err := parseEndpoint(endpoint)
+	if err != nil {
+		return "", err
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = path
+	} else if !strings.HasSuffix(u.Path, "/") {
+		u.Path += "/"
+	}
+	return u.String(), nil
+}
+
+// parseEndpoint parses a URL, or a host taken to be served over https.
+func parseEndpoint(endpoint string) (*url.URL, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		u, err = url.Parse("https://" + endpoint)
+	}
+	if err != nil || u.Host == "" || (u.Scheme != "https" && u.Scheme != "http") {
+		return nil, fmt.Errorf("invalid endpoint %q, want a URL such as https://host:port", endpoint)
+	}
+	return u, nil
+}
+
+// iamURL returns the IAM token endpoint used for an instance in regionName:
+// the endpoint configured, otherwise the test IAM for the stage region, the
+// private IAM for private regions and the public IAM for the others. The
+// configured endpoint may be a full URL or just a host such as
+// private.iam.cloud.ibm.com.
+func iamURL(configured, regionName string) (string, error) {
+	if configured == "" {
+		r, private, _ := lookupRegion(regionName)
+		switch {
+		case r.test:
+			return iam.TestURL, nil
+		case private:
+			return iam.PrivateURL, nil
+		}
+		return iam.DefaultURL, nil
+	}
+	u, err := parseEndpoint(configured)
+	if err != nil {
+		return "", fmt.Errorf("invalid IAM endpoint %q, please check setEnv.sh and source it", configured)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = iam.TokenPath
+	}
+	return u.String(), nil
+}
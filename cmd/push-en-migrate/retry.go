@@ -0,0 +1,177 @@
+/**
+ * (C) Copyright IBM Corp. 2022.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Event-Notifications/push-en-migration-tool/deadletter"
+	"github.com/Event-Notifications/push-en-migration-tool/iam"
+)
+
+func runRetryFailed(args []string) error {
+	fs := flag.NewFlagSet("retry-failed", flag.ExitOnError)
+	var pool poolOptions
+	pool.register(fs)
+	devicesFile := fs.String("devices-file", "devices.csv", "exported devices whose platforms decide the destination of each subscription")
+	devicesJournal := fs.String("devices-journal", "devices.journal", "journal of the device import")
+	subscriptionsJournal := fs.String("subscriptions-journal", "subscription.journal", "journal of the subscription import")
+	s := loadSettings()
+	s.registerENFlags(fs)
+	cfg := registerConfigFlags(fs)
+	fs.Parse(args)
+	if err := cfg.apply(fs, &s); err != nil {
+		return err
+	}
+	if err := pool.validate(); err != nil {
+		return err
+	}
+
+	ctx, cancel := signalContext(pool.DrainTimeout)
+	defer cancel()
+	stopControl, err := pool.serveControl()
+	if err != nil {
+		return err
+	}
+	defer stopControl()
+	imp, err := newImporter(ctx, s, pool)
+	if err != nil {
+		return err
+	}
+
+	// Devices failing again do not keep the subscriptions from being
+	// retried, only a stop or invalid credentials do.
+	var errs []error
+	if err := retryFailed(ctx, imp, imp.devices(), *devicesJournal); err != nil {
+		errs = append(errs, fmt.Errorf("retry devices: %w", err))
+		if interrupted(err) || stopped(ctx) || errors.Is(err, iam.ErrCredentialsInvalid) {
+			return errors.Join(errs...)
+		}
+	}
+	if retryPending(imp.subscriptions()) {
+		if imp.platforms, err = loadDevicePlatforms(*devicesFile); err != nil {
+			return errors.Join(append(errs, err)...)
+		}
+	}
+	if err := retryFailed(ctx, imp, imp.subscriptions(), *subscriptionsJournal); err != nil {
+		errs = append(errs, fmt.Errorf("retry subscriptions: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+// retryPending reports whether target has a dead letter file to retry.
+func retryPending(target importTarget) bool {
+	for _, path := range []string{target.failedFile, target.failedFile + ".retrying"} {
+		if _, err := os.Stat(path); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// retryFailed imports the retriable rows of the dead letter file of target
+// again. The file is moved aside while they are retried and rebuilt from its
+// permanent failures plus the rows that fail again. If a previous retry was
+// interrupted the file moved aside by it is retried instead. A retry with
+// more failures than --max-failures is finished all the same, and returns
+// an error once the file moved aside is removed.
+func retryFailed(ctx context.Context, imp *importer, target importTarget, journal string) error {
+	retrying := target.failedFile + ".retrying"
+	if _, err := os.Stat(retrying); errors.Is(err, os.ErrNotExist) {
+		if err := os.Rename(target.failedFile, retrying); errors.Is(err, os.ErrNotExist) {
+			fmt.Println("No failures to retry in", target.failedFile)
+			return nil
+		} else if err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	} else {
+		fmt.Println("Continuing interrupted retry of", retrying)
+	}
+
+	permanent, err := keepPermanent(retrying, target.failedFile)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Kept", permanent, "permanent failures in", target.failedFile)
+
+	r, err := deadletter.Open(retrying)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	next := func() ([]string, error) {
+		for {
+			e, err := r.Next()
+			if err != nil {
+				return nil, err
+			}
+			if e.Retriable {
+				return e.Record, nil
+			}
+		}
+	}
+
+	opts := importOptions{Journal: journal, Resume: true, keepFailures: true}
+	err = imp.run(ctx, opts, target, next)
+	if err != nil && !errors.Is(err, errTooManyFailures) {
+		return err
+	}
+	r.Close()
+	return errors.Join(err, os.Remove(retrying))
+}
+
+// keepPermanent writes the entries of the dead letter file src that are not
+// retriable to a new dead letter file dst and returns how many there were.
+func keepPermanent(src, dst string) (int, error) {
+	r, err := deadletter.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+	w, err := deadletter.Create(dst, false)
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for {
+		e, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			w.Close()
+			return n, err
+		}
+		if e.Retriable {
+			continue
+		}
+		if err := w.Write(e); err != nil {
+			w.Close()
+			return n, err
+		}
+		n++
+	}
+	return n, w.Close()
+}
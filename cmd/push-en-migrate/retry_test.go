@@ -0,0 +1,71 @@
+/**
+ * (C) Copyright IBM Corp. 2022.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Event-Notifications/push-en-migration-tool/deadletter"
+)
+
+func writeDeadLetters(t *testing.T, path string, entries ...deadletter.Entry) {
+	t.Helper()
+	w, err := deadletter.Create(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if err := w.Write(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRetryFailedFinishesOverThreshold(t *testing.T) {
+	ti := newTestImport(t)
+	ti.imp.pool.MaxFailures = failureThreshold{}
+	ti.fail = map[string]bool{"d2": true}
+	now := time.Now().UTC()
+	writeDeadLetters(t, ti.target.failedFile,
+		deadletter.Entry{Record: []string{"d1", "u", "t", "A"}, Category: "server", Retriable: true, Time: now},
+		deadletter.Entry{Record: []string{"d2", "u", "t", "A"}, Category: "server", Retriable: true, Time: now},
+		deadletter.Entry{Record: []string{"d3", "u", "t", "X"}, Category: "validation", Time: now},
+	)
+
+	err := retryFailed(context.Background(), ti.imp, ti.target, ti.opts.Journal)
+	if !errors.Is(err, errTooManyFailures) {
+		t.Fatalf("retryFailed() = %v, want errTooManyFailures", err)
+	}
+	if _, err := os.Stat(ti.target.failedFile + ".retrying"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("retry over the threshold left %s.retrying: %v", ti.target.failedFile, err)
+	}
+	var ids []string
+	for _, e := range readDeadLetters(t, ti.target.failedFile) {
+		ids = append(ids, e.Record[0])
+	}
+	if want := []string{"d3", "d2"}; !slices.Equal(ids, want) {
+		t.Errorf("dead letters %v, want %v", ids, want)
+	}
+}
@@ -0,0 +1,166 @@
+/**
+ * (C) Copyright IBM Corp. 2022.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"cmp"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/Event-Notifications/push-en-migration-tool/secret"
+)
+
+const defaultKeystore = "push-en-migrate.keystore"
+
+// secrets resolves the file:, env:, stdin: and keystore: references given
+// for API keys and secrets in setEnv.sh or the configuration file.
+var secrets = &secret.Resolver{Keystore: openKeystore}
+
+func keystorePath() string {
+	return cmp.Or(os.Getenv("PUSH_EN_MIGRATE_KEYSTORE"), defaultKeystore)
+}
+
+// keystorePassphrase returns the passphrase of the keystore from
+// PUSH_EN_MIGRATE_KEYSTORE_PASSPHRASE, which may itself be a file:, env: or
+// stdin: reference.
+func keystorePassphrase(secrets *secret.Resolver) (string, error) {
+	ref := os.Getenv("PUSH_EN_MIGRATE_KEYSTORE_PASSPHRASE")
+	if ref == "" {
+		return "", errors.New("PUSH_EN_MIGRATE_KEYSTORE_PASSPHRASE is not set, please set it to the keystore passphrase or a file: reference to it")
+	}
+	if scheme, _ := secret.Parse(ref); scheme == secret.SchemeKeystore {
+		return "", errors.New("PUSH_EN_MIGRATE_KEYSTORE_PASSPHRASE cannot be a keystore: reference")
+	}
+	passphrase, err := secrets.Resolve(ref)
+	if err != nil {
+		return "", fmt.Errorf("PUSH_EN_MIGRATE_KEYSTORE_PASSPHRASE: %w", err)
+	}
+	return passphrase, nil
+}
+
+func openKeystore(r *secret.Resolver) (*secret.Keystore, error) {
+	passphrase, err := keystorePassphrase(r)
+	if err != nil {
+		return nil, err
+	}
+	return secret.OpenKeystore(keystorePath(), passphrase, false)
+}
+
+// resolveSecret returns the secret the setting named name refers to. The
+// error names the setting but never its value.
+func resolveSecret(name, ref string) (string, error) {
+	if ref == "" {
+		return "", nil
+	}
+	v, err := secrets.Resolve(ref)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", name, err)
+	}
+	return v, nil
+}
+
+func registerKeystoreFlag(fs *flag.FlagSet) *string {
+	return fs.String("keystore", keystorePath(), "encrypted keystore file, PUSH_EN_MIGRATE_KEYSTORE by default")
+}
+
+// runKeystoreSet stores the secret read from the standard input in the
+// keystore, creating it if needed. The secret is not taken as an argument
+// so that it does not end up in the shell history.
+func runKeystoreSet(args []string) error {
+	fs := flag.NewFlagSet("keystore set", flag.ExitOnError)
+	path := registerKeystoreFlag(fs)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("%w: keystore set needs the name of the secret, such as \"keystore set en-apikey\"", errUsage)
+	}
+	name := fs.Arg(0)
+
+	passphrase, err := keystorePassphrase(secrets)
+	if err != nil {
+		return err
+	}
+	ks, err := secret.OpenKeystore(*path, passphrase, true)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, "Reading the secret", name, "from standard input")
+	value, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return err
+	}
+	v := strings.TrimSpace(string(value))
+	if v == "" {
+		return fmt.Errorf("no secret given on standard input for %s", name)
+	}
+	ks.Set(name, v)
+	if err := ks.Save(); err != nil {
+		return err
+	}
+	fmt.Println("Stored", name, "in", *path+", use it as keystore:"+name)
+	return nil
+}
+
+func runKeystoreDelete(args []string) error {
+	fs := flag.NewFlagSet("keystore delete", flag.ExitOnError)
+	path := registerKeystoreFlag(fs)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("%w: keystore delete needs the name of the secret", errUsage)
+	}
+
+	passphrase, err := keystorePassphrase(secrets)
+	if err != nil {
+		return err
+	}
+	ks, err := secret.OpenKeystore(*path, passphrase, false)
+	if err != nil {
+		return err
+	}
+	if !ks.Delete(fs.Arg(0)) {
+		return fmt.Errorf("%s has no secret %s", *path, fs.Arg(0))
+	}
+	if err := ks.Save(); err != nil {
+		return err
+	}
+	fmt.Println("Deleted", fs.Arg(0), "from", *path)
+	return nil
+}
+
+// runKeystoreList prints the names of the secrets in the keystore, never
+// their values.
+func runKeystoreList(args []string) error {
+	fs := flag.NewFlagSet("keystore list", flag.ExitOnError)
+	path := registerKeystoreFlag(fs)
+	fs.Parse(args)
+
+	passphrase, err := keystorePassphrase(secrets)
+	if err != nil {
+		return err
+	}
+	ks, err := secret.OpenKeystore(*path, passphrase, false)
+	if err != nil {
+		return err
+	}
+	for _, name := range ks.Names() {
+		fmt.Println(name)
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+/**
+ * (C) Copyright IBM Corp. 2022.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"cmp"
+	"flag"
+	"os"
+	"sync"
+
+	"github.com/Event-Notifications/push-en-migration-tool/iam"
+)
+
+// settings holds the configuration sourced from setEnv.sh.
+type settings struct {
+	PushRegion       string
+	PushInstanceID   string
+	PushAPIKey       string
+	PushClientSecret string
+	PushAppSecret    string
+	// PushEndpoint and ENEndpoint override the base URL of the region.
+	PushEndpoint string
+	// PushIAMURL and ENIAMURL are the configured IAM token endpoints,
+	// empty for the default of the region.
+	PushIAMURL string
+	// PushProfileID and ENProfileID select trusted profile authentication
+	// with the compute resource token in PushCRTokenFile and ENCRTokenFile
+	// instead of the API key.
+	PushProfileID   string
+	PushCRTokenFile string
+
+	ENRegion               string
+	ENInstanceID           string
+	ENAPIKey               string
+	ENIOSDestinationID     string
+	ENAndroidDestinationID string
+	ENIAMURL               string
+	ENProfileID            string
+	ENCRTokenFile          string
+	ENEndpoint             string
+}
+
+func loadSettings() settings {
+	return settings{
+		PushRegion:       os.Getenv("PUSH_INSTANCE_REGION"),
+		PushInstanceID:   os.Getenv("PUSH_INSTANCE_ID"),
+		PushAPIKey:       os.Getenv("PUSH_APIKEY"),
+		PushClientSecret: os.Getenv("PUSH_CLIENT_SECRET"),
+		PushAppSecret:    os.Getenv("PUSH_APP_SECRET"),
+		PushEndpoint:     os.Getenv("PUSH_ENDPOINT"),
+		PushIAMURL:       cmp.Or(os.Getenv("PUSH_IAM_URL"), os.Getenv("IAM_URL")),
+		PushProfileID:    os.Getenv("PUSH_TRUSTED_PROFILE_ID"),
+		PushCRTokenFile:  os.Getenv("PUSH_CR_TOKEN_FILE"),
+
+		ENRegion:               os.Getenv("EN_INSTANCE_REGION"),
+		ENInstanceID:           os.Getenv("EN_INSTANCE_ID"),
+		ENAPIKey:               os.Getenv("EN_APIKEY"),
+		ENIOSDestinationID:     os.Getenv("EN_IOS_DESTINATION_ID"),
+		ENAndroidDestinationID: os.Getenv("EN_ANDROID_DESTINATION_ID"),
+		ENIAMURL:               cmp.Or(os.Getenv("EN_IAM_URL"), os.Getenv("IAM_URL")),
+		ENProfileID:            os.Getenv("EN_TRUSTED_PROFILE_ID"),
+		ENCRTokenFile:          os.Getenv("EN_CR_TOKEN_FILE"),
+		ENEndpoint:             os.Getenv("EN_ENDPOINT"),
+	}
+}
+
+// registerPushFlags adds the flags overriding the Push settings.
+func (s *settings) registerPushFlags(fs *flag.FlagSet) {
+	fs.StringVar(&s.PushEndpoint, "push-endpoint", s.PushEndpoint, "base URL of Push Notifications replacing the one of PUSH_INSTANCE_REGION, such as http://localhost:8080")
+}
+
+// registerENFlags adds the flags overriding the EN settings.
+func (s *settings) registerENFlags(fs *flag.FlagSet) {
+	fs.StringVar(&s.ENEndpoint, "en-endpoint", s.ENEndpoint, "base URL of Event Notifications replacing the one of EN_INSTANCE_REGION, such as http://localhost:8080")
+}
+
+// credentials authenticate one side of the migration with IAM: an API key,
+// or a trusted profile with a compute resource token.
+type credentials struct {
+	IAMURL      string
+	APIKey      string
+	ProfileID   string
+	CRTokenFile string
+}
+
+// pushCredentials returns the credentials of the Push instance, with the
+// API key resolved if it is a reference.
+func (s settings) pushCredentials() (credentials, error) {
+	return newCredentials(s.PushIAMURL, s.PushRegion, "PUSH_APIKEY", s.PushAPIKey, s.PushProfileID, s.PushCRTokenFile)
+}
+
+// enCredentials returns the credentials of the EN instance, with the API
+// key resolved if it is a reference.
+func (s settings) enCredentials() (credentials, error) {
+	return newCredentials(s.ENIAMURL, s.ENRegion, "EN_APIKEY", s.ENAPIKey, s.ENProfileID, s.ENCRTokenFile)
+}
+
+func newCredentials(configuredIAM, region, apiKeyName, apiKey, profileID, crTokenFile string) (credentials, error) {
+	tokenURL, err := iamURL(configuredIAM, region)
+	if err != nil {
+		return credentials{}, err
+	}
+	if profileID != "" {
+		// A trusted profile ignores the API key, which need not resolve.
+		return credentials{tokenURL, "", profileID, crTokenFile}, nil
+	}
+	apiKey, err = resolveSecret(apiKeyName, apiKey)
+	return credentials{tokenURL, apiKey, "", crTokenFile}, err
+}
+
+var (
+	authMu         sync.Mutex
+	authenticators = map[credentials]*iam.Authenticator{}
+)
+
+// authenticator returns the token manager of c. Every client of the
+// process using the same credentials shares it, so that its token is
+// fetched and refreshed once for the Push export and the EN import alike.
+func authenticator(c credentials) *iam.Authenticator {
+	authMu.Lock()
+	defer authMu.Unlock()
+	a, ok := authenticators[c]
+	if !ok {
+		if c.ProfileID != "" {
+			a = iam.NewTrustedProfileAuthenticator(c.ProfileID, c.CRTokenFile)
+		} else {
+			a = iam.NewAuthenticator(c.APIKey)
+		}
+		a.URL = c.IAMURL
+		authenticators[c] = a
+	}
+	return a
+}
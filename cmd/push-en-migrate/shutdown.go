@@ -0,0 +1,90 @@
+/**
+ * (C) Copyright IBM Corp. 2022.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// errInterrupted is returned by a command stopped by SIGINT or SIGTERM once
+// the work in flight is written out.
+var errInterrupted = errors.New("interrupted")
+
+type stopKey struct{}
+
+// signalContext returns the context of a command that stops gracefully on
+// SIGINT or SIGTERM. On the first signal the channel returned by stopping is
+// closed, so that no new rows or pages are started, and the context is
+// cancelled drain later to abort the requests still in flight. A second
+// signal cancels it at once.
+func signalContext(drain time.Duration) (context.Context, context.CancelFunc) {
+	stop := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), stopKey{}, (<-chan struct{})(stop)))
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		defer signal.Stop(signals)
+		select {
+		case sig := <-signals:
+			fmt.Println("Received", sig, "- finishing requests in flight for up to", drain, "- signal again to stop now")
+			close(stop)
+		case <-ctx.Done():
+			return
+		}
+
+		timer := time.NewTimer(drain)
+		defer timer.Stop()
+		select {
+		case <-signals:
+			fmt.Println("Stopping now")
+		case <-timer.C:
+			fmt.Println("Requests still in flight after", drain, "are cancelled")
+		case <-ctx.Done():
+		}
+		cancel()
+	}()
+	return ctx, cancel
+}
+
+// stopping returns the channel closed when the command of ctx is asked to
+// stop, or nil if it cannot be.
+func stopping(ctx context.Context) <-chan struct{} {
+	stop, _ := ctx.Value(stopKey{}).(<-chan struct{})
+	return stop
+}
+
+// stopped reports whether the command of ctx was asked to stop.
+func stopped(ctx context.Context) bool {
+	select {
+	case <-stopping(ctx):
+		return true
+	default:
+		return false
+	}
+}
+
+// interrupted reports whether err ended a command stopped by a signal.
+func interrupted(err error) bool {
+	return errors.Is(err, errInterrupted) || errors.Is(err, context.Canceled)
+}
@@ -0,0 +1,144 @@
+/**
+ * (C) Copyright IBM Corp. 2022.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/Event-Notifications/push-en-migration-tool/deadletter"
+	"github.com/Event-Notifications/push-en-migration-tool/journal"
+)
+
+// flushInterval is how often the result files are written to disk.
+const flushInterval = time.Second
+
+// resultSink is the only writer of the success and dead letter files of an
+// import, and of its journal. Workers hand it their rows over a channel and
+// a single goroutine writes them, so rows are never interleaved. It flushes
+// and syncs the files every flushInterval and once more when closed. The
+// journal keys of migrated rows are only written once their rows are synced
+// to the success file, so that a row skipped on resume is never missing
+// from it.
+type resultSink struct {
+	results chan sinkResult
+	done    chan struct{}
+	err     error
+	// pending are the journal keys of the rows written to the success
+	// file since the last sync.
+	pending [][]string
+
+	succFile    *os.File
+	succ        *csv.Writer
+	deadLetters *deadletter.Writer
+	journal     *journal.Journal
+}
+
+// sinkResult is either a migrated row and its journal key or a failure.
+type sinkResult struct {
+	migrated []string
+	key      []string
+	failed   *deadletter.Entry
+}
+
+// newResultSink starts a sink writing to succFile and deadLetters, which it
+// closes when it is closed.
+func newResultSink(succFile *os.File, deadLetters *deadletter.Writer, j *journal.Journal) *resultSink {
+	s := &resultSink{
+		results:     make(chan sinkResult, 64),
+		done:        make(chan struct{}),
+		succFile:    succFile,
+		succ:        csv.NewWriter(succFile),
+		deadLetters: deadLetters,
+		journal:     j,
+	}
+	go s.loop()
+	return s
+}
+
+func (s *resultSink) loop() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case r, ok := <-s.results:
+			if !ok {
+				s.setErr(s.sync())
+				s.setErr(s.succFile.Close())
+				s.setErr(s.deadLetters.Close())
+				return
+			}
+			if r.migrated != nil {
+				s.setErr(s.succ.Write(r.migrated))
+				s.pending = append(s.pending, r.key)
+			}
+			if r.failed != nil {
+				s.setErr(s.deadLetters.Write(*r.failed))
+			}
+		case <-ticker.C:
+			s.setErr(s.sync())
+		}
+	}
+}
+
+// sync commits the success and dead letter files to disk, and then the
+// journal keys of the rows synced. The keys are dropped if the success file
+// cannot be synced, leaving their rows to be imported again on resume.
+func (s *resultSink) sync() error {
+	s.succ.Flush()
+	err := errors.Join(s.succ.Error(), s.succFile.Sync())
+	if err == nil {
+		for _, key := range s.pending {
+			if err = s.journal.Record(key...); err != nil {
+				break
+			}
+		}
+		err = errors.Join(err, s.journal.Sync())
+	}
+	s.pending = s.pending[:0]
+	return errors.Join(err, s.deadLetters.Sync())
+}
+
+// setErr keeps the first write error. It is only called by loop.
+func (s *resultSink) setErr(err error) {
+	if s.err == nil {
+		s.err = err
+	}
+}
+
+// migrated queues a row for the success file and its key for the journal.
+func (s *resultSink) migrated(record, key []string) {
+	s.results <- sinkResult{migrated: record, key: key}
+}
+
+// failed queues an entry for the dead letter file.
+func (s *resultSink) failed(e deadletter.Entry) {
+	s.results <- sinkResult{failed: &e}
+}
+
+// close writes the queued rows, syncs and closes the files, and returns the
+// first error met while writing. It must be called once, after every
+// worker is done.
+func (s *resultSink) close() error {
+	close(s.results)
+	<-s.done
+	return s.err
+}
@@ -0,0 +1,73 @@
+/**
+ * (C) Copyright IBM Corp. 2022.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Event-Notifications/push-en-migration-tool/deadletter"
+	"github.com/Event-Notifications/push-en-migration-tool/journal"
+)
+
+func TestResultSinkJournalsSyncedRows(t *testing.T) {
+	dir := t.TempDir()
+	journalPath := filepath.Join(dir, "devices.journal")
+	succPath := filepath.Join(dir, "migrated_devices.csv")
+	j, err := journal.Open(journalPath, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	deadLetters, err := deadletter.Create(filepath.Join(dir, "failed_devices.jsonl"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	succFile, err := os.Create(succPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := newResultSink(succFile, deadLetters, j)
+	for _, id := range []string{"d1", "d2", "d3"} {
+		s.migrated([]string{id, "u", "t", "A"}, []string{id})
+	}
+	// The rows are not synced to the success file before the next flush,
+	// and neither are their keys to the journal.
+	if b, err := os.ReadFile(journalPath); err != nil || len(b) != 0 {
+		t.Errorf("journal before sync = %q, %v, want it empty", b, err)
+	}
+	if err := s.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	succ, err := os.ReadFile(succPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "d1,u,t,A\nd2,u,t,A\nd3,u,t,A\n"; string(succ) != want {
+		t.Errorf("success file = %q, want %q", succ, want)
+	}
+	keys, err := os.ReadFile(journalPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "d1\nd2\nd3\n"; string(keys) != want {
+		t.Errorf("journal = %q, want %q", keys, want)
+	}
+}
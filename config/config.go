@@ -0,0 +1,309 @@
+/**
+ * (C) Copyright IBM Corp. 2022.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package config reads migration settings from a configuration file with
+// named profiles.
+//
+// The file is written in a subset of TOML: comments, [dotted.table]
+// headers and key = value pairs whose value is a string, an integer, a
+// float or a boolean. A profile is the table profiles.<name> and its
+// sub-tables:
+//
+//	profile = "staging"
+//
+//	[profiles.staging.push]
+//	region = "stage"
+//	instance_id = "..."
+//
+//	[profiles.staging.import]
+//	workers = 30
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Kind is the type of a Value.
+type Kind int
+
+const (
+	String Kind = iota
+	Integer
+	Float
+	Bool
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Integer:
+		return "integer"
+	case Float:
+		return "float"
+	case Bool:
+		return "boolean"
+	}
+	return "string"
+}
+
+// Value is a value of the file.
+type Value struct {
+	Kind Kind
+	// Text is the decoded string, or the literal of other kinds.
+	Text string
+	// Line is the line the value is on.
+	Line int
+}
+
+// File is a parsed configuration file.
+type File struct {
+	Path string
+	// values holds every value by its full dotted key.
+	values map[string]Value
+}
+
+// Error is a syntax error in a configuration file. It gives the line
+// rather than its text, which may hold a secret.
+type Error struct {
+	Path string
+	Line int
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("config: %s:%d: %s", e.Path, e.Line, e.Msg)
+}
+
+// Load reads the configuration file at path.
+func Load(path string) (*File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Parse(path, f)
+}
+
+// Parse reads a configuration file from r. path names it in errors.
+func Parse(path string, r io.Reader) (*File, error) {
+	file := &File{Path: path, values: make(map[string]Value)}
+	tables := map[string]bool{}
+	table := ""
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		fail := func(format string, args ...any) error {
+			return &Error{Path: path, Line: n, Msg: fmt.Sprintf(format, args...)}
+		}
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		if line[0] == '[' {
+			end := strings.IndexByte(line, ']')
+			if end < 0 || strings.HasPrefix(line, "[[") {
+				return nil, fail("invalid table header")
+			}
+			if rest := strings.TrimSpace(line[end+1:]); rest != "" && rest[0] != '#' {
+				return nil, fail("unexpected text after table header")
+			}
+			table = strings.TrimSpace(line[1:end])
+			for _, part := range strings.Split(table, ".") {
+				if !bareKey(part) {
+					return nil, fail("invalid table name, names are made of letters, digits, _ and - separated by dots")
+				}
+			}
+			if tables[table] {
+				return nil, fail("table [%s] defined twice", table)
+			}
+			if _, ok := file.values[table]; ok {
+				return nil, fail("table [%s] redefines a key", table)
+			}
+			tables[table] = true
+			continue
+		}
+
+		eq := strings.IndexByte(line, '=')
+		if eq < 0 {
+			return nil, fail("expected key = value")
+		}
+		key := strings.TrimSpace(line[:eq])
+		if !bareKey(key) {
+			return nil, fail("invalid key, keys are made of letters, digits, _ and -")
+		}
+		v, err := parseValue(strings.TrimSpace(line[eq+1:]))
+		if err != nil {
+			return nil, fail("%s: %v", key, err)
+		}
+		v.Line = n
+
+		if table != "" {
+			key = table + "." + key
+		}
+		if _, ok := file.values[key]; ok {
+			return nil, fail("%s set twice", key)
+		}
+		if tables[key] {
+			return nil, fail("%s is already a table", key)
+		}
+		file.values[key] = v
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+func bareKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for _, c := range key {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// parseValue parses a value followed by an optional comment.
+func parseValue(s string) (Value, error) {
+	switch {
+	case s == "":
+		return Value{}, fmt.Errorf("missing value")
+	case s[0] == '"':
+		return parseBasicString(s)
+	case s[0] == '\'':
+		end := strings.IndexByte(s[1:], '\'')
+		if end < 0 {
+			return Value{}, fmt.Errorf("unterminated string")
+		}
+		return Value{Kind: String, Text: s[1 : end+1]}, trailing(s[end+2:])
+	case s[0] == '[' || s[0] == '{':
+		return Value{}, fmt.Errorf("arrays and inline tables are not supported")
+	}
+
+	literal, _, _ := strings.Cut(s, "#")
+	literal = strings.TrimSpace(literal)
+	switch {
+	case literal == "true" || literal == "false":
+		return Value{Kind: Bool, Text: literal}, nil
+	case isInteger(literal):
+		return Value{Kind: Integer, Text: strings.ReplaceAll(literal, "_", "")}, nil
+	}
+	if _, err := strconv.ParseFloat(strings.ReplaceAll(literal, "_", ""), 64); err == nil {
+		return Value{Kind: Float, Text: strings.ReplaceAll(literal, "_", "")}, nil
+	}
+	return Value{}, fmt.Errorf("invalid value, strings must be quoted")
+}
+
+func isInteger(s string) bool {
+	_, err := strconv.ParseInt(strings.ReplaceAll(s, "_", ""), 10, 64)
+	return err == nil
+}
+
+func parseBasicString(s string) (Value, error) {
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"':
+			return Value{Kind: String, Text: b.String()}, trailing(s[i+1:])
+		case '\\':
+			i++
+			if i == len(s) {
+				return Value{}, fmt.Errorf("unterminated string")
+			}
+			switch s[i] {
+			case '"', '\\':
+				b.WriteByte(s[i])
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			default:
+				return Value{}, fmt.Errorf("unsupported escape sequence")
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return Value{}, fmt.Errorf("unterminated string")
+}
+
+// trailing checks that only a comment follows a value.
+func trailing(s string) error {
+	s = strings.TrimSpace(s)
+	if s != "" && s[0] != '#' {
+		return fmt.Errorf("unexpected text after value")
+	}
+	return nil
+}
+
+// Get returns the value of the full dotted key.
+func (f *File) Get(key string) (Value, bool) {
+	v, ok := f.values[key]
+	return v, ok
+}
+
+// Profiles returns the names of the profiles of the file, sorted.
+func (f *File) Profiles() []string {
+	var names []string
+	for key := range f.values {
+		rest, ok := strings.CutPrefix(key, "profiles.")
+		if !ok {
+			continue
+		}
+		name, _, _ := strings.Cut(rest, ".")
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Profile returns the values of the profile name keyed relative to it, such
+// as "push.region", or false if the file has no such profile.
+func (f *File) Profile(name string) (map[string]Value, bool) {
+	prefix := "profiles." + name + "."
+	values := make(map[string]Value)
+	for key, v := range f.values {
+		if rest, ok := strings.CutPrefix(key, prefix); ok {
+			values[rest] = v
+		}
+	}
+	return values, len(values) > 0
+}
+
+// Keys returns the full dotted keys of the values outside any profile,
+// sorted.
+func (f *File) Keys() []string {
+	var keys []string
+	for key := range f.values {
+		if !strings.HasPrefix(key, "profiles.") {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	return keys
+}
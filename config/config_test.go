@@ -0,0 +1,141 @@
+/**
+ * (C) Copyright IBM Corp. 2022.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	input := `# Profile used by default.
+profile = "staging"
+
+[profiles.staging.push]   # Push side
+region = "stage"
+apikey = 'C:\keys\push'  # literal strings keep backslashes
+instance_id = "app \"one\"\t\\ x\n"
+
+[profiles.staging.import]
+workers = 1_000
+adaptive = true
+rate = 2.5
+burst = -3
+
+[profiles.prod-eu.en]
+region = "frankfurt"
+`
+	f, err := Parse("test.toml", strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		key  string
+		want Value
+	}{
+		{"profile", Value{Kind: String, Text: "staging", Line: 2}},
+		{"profiles.staging.push.region", Value{Kind: String, Text: "stage", Line: 5}},
+		{"profiles.staging.push.apikey", Value{Kind: String, Text: `C:\keys\push`, Line: 6}},
+		{"profiles.staging.push.instance_id", Value{Kind: String, Text: "app \"one\"\t\\ x\n", Line: 7}},
+		{"profiles.staging.import.workers", Value{Kind: Integer, Text: "1000", Line: 10}},
+		{"profiles.staging.import.adaptive", Value{Kind: Bool, Text: "true", Line: 11}},
+		{"profiles.staging.import.rate", Value{Kind: Float, Text: "2.5", Line: 12}},
+		{"profiles.staging.import.burst", Value{Kind: Integer, Text: "-3", Line: 13}},
+		{"profiles.prod-eu.en.region", Value{Kind: String, Text: "frankfurt", Line: 16}},
+	}
+	for _, tt := range tests {
+		got, ok := f.Get(tt.key)
+		if !ok {
+			t.Errorf("Get(%q) not found", tt.key)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Get(%q) = %+v, want %+v", tt.key, got, tt.want)
+		}
+	}
+
+	if got, want := f.Profiles(), []string{"prod-eu", "staging"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Profiles() = %q, want %q", got, want)
+	}
+	if got, want := f.Keys(), []string{"profile"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Keys() = %q, want %q", got, want)
+	}
+	staging, ok := f.Profile("staging")
+	if !ok || len(staging) != 7 || staging["import.workers"].Text != "1000" {
+		t.Errorf("Profile(staging) = %v, %v", staging, ok)
+	}
+	if _, ok := f.Profile("missing"); ok {
+		t.Error("Profile(missing) found")
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	// secret stands for an API key mistyped in the file. It must not be
+	// repeated by any error, which may end up in logs.
+	const secret = "s3cr3tK3y"
+
+	tests := []struct {
+		name  string
+		input string
+		line  int
+		msg   string
+	}{
+		{"unclosed table header", "[profiles.a", 1, "invalid table header"},
+		{"array of tables", "[[profiles]]", 1, "invalid table header"},
+		{"text after table header", "[profiles.a] " + secret, 1, "unexpected text after table header"},
+		{"empty table name part", "[profiles..a]", 1, "invalid table name"},
+		{"table name with space", "[profiles " + secret + "]", 1, "invalid table name"},
+		{"table defined twice", "[a]\nx = 1\n[a]", 3, "table [a] defined twice"},
+		{"no equals sign", "apikey " + secret, 1, "expected key = value"},
+		{"invalid key", "api key" + secret + " = 1", 1, "invalid key"},
+		{"missing value", "apikey =", 1, "apikey: missing value"},
+		{"missing value with comment", "apikey = # " + secret, 1, "apikey: invalid value"},
+		{"unquoted string", "apikey = " + secret, 1, "apikey: invalid value, strings must be quoted"},
+		{"unterminated string", `apikey = "` + secret, 1, "apikey: unterminated string"},
+		{"unterminated escape", `apikey = "` + secret + `\`, 1, "apikey: unterminated string"},
+		{"unterminated literal string", "apikey = '" + secret, 1, "apikey: unterminated string"},
+		{"unsupported escape", `apikey = "` + secret + `\q"`, 1, "apikey: unsupported escape sequence"},
+		{"text after string", `apikey = "x" ` + secret, 1, "apikey: unexpected text after value"},
+		{"text after literal string", `apikey = 'x' ` + secret, 1, "apikey: unexpected text after value"},
+		{"array", "apikey = [\"" + secret + "\"]", 1, "apikey: arrays and inline tables are not supported"},
+		{"inline table", "apikey = {key = \"" + secret + "\"}", 1, "apikey: arrays and inline tables are not supported"},
+		{"key set twice", "\n[a]\nx = 1\nx = 2", 4, "a.x set twice"},
+		{"table redefining a key", "[a]\nx = 1\n[a.x]", 3, "table [a.x] redefines a key"},
+		{"key naming a table", "[a.x]\ny = 1\n[a]\nx = 2", 4, "a.x is already a table"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse("test.toml", strings.NewReader(tt.input))
+			var cfgErr *Error
+			if !errors.As(err, &cfgErr) {
+				t.Fatalf("Parse() = %v, want an *Error", err)
+			}
+			if cfgErr.Path != "test.toml" || cfgErr.Line != tt.line {
+				t.Errorf("error at %s:%d, want test.toml:%d", cfgErr.Path, cfgErr.Line, tt.line)
+			}
+			if !strings.Contains(cfgErr.Msg, tt.msg) {
+				t.Errorf("error %q does not contain %q", cfgErr.Msg, tt.msg)
+			}
+			if strings.Contains(err.Error(), secret) {
+				t.Errorf("error %q repeats the value of the line", err)
+			}
+		})
+	}
+}
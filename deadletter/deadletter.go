@@ -0,0 +1,138 @@
+/**
+ * (C) Copyright IBM Corp. 2022.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package deadletter stores the rows an import could not migrate as JSON
+// lines, one Entry per line, together with why they failed.
+package deadletter
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Entry is a row that failed to migrate.
+type Entry struct {
+	// Record is the row as read from the exported file.
+	Record        []string `json:"record"`
+	DestinationID string   `json:"destination_id,omitempty"`
+	// Category classifies the failure, such as "validation" or
+	// "throttled".
+	Category string `json:"category"`
+	// Retriable is set if the row may succeed when tried again later.
+	Retriable  bool      `json:"retriable"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Body       string    `json:"body,omitempty"`
+	Error      string    `json:"error"`
+	Attempts   int       `json:"attempts"`
+	Time       time.Time `json:"time"`
+}
+
+// Writer appends entries to a dead letter file. It is safe for concurrent
+// use.
+type Writer struct {
+	mu  sync.Mutex
+	f   *os.File
+	buf *bufio.Writer
+	enc *json.Encoder
+}
+
+// Create opens the dead letter file at path, truncating it unless keep is
+// set.
+func Create(path string, keep bool) (*Writer, error) {
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if keep {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	f, err := os.OpenFile(path, flags, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	buf := bufio.NewWriter(f)
+	return &Writer{f: f, buf: buf, enc: json.NewEncoder(buf)}, nil
+}
+
+// Write appends e.
+func (w *Writer) Write(e Entry) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.enc.Encode(e)
+}
+
+// Flush writes buffered entries to the file.
+func (w *Writer) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.Flush()
+}
+
+// Sync writes buffered entries to the file and commits it to disk.
+func (w *Writer) Sync() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.buf.Flush(); err != nil {
+		return err
+	}
+	return w.f.Sync()
+}
+
+// Close flushes and closes the file.
+func (w *Writer) Close() error {
+	if err := w.Flush(); err != nil {
+		w.f.Close()
+		return err
+	}
+	return w.f.Close()
+}
+
+// Reader reads the entries of a dead letter file in order.
+type Reader struct {
+	f    *os.File
+	dec  *json.Decoder
+	path string
+	n    int
+}
+
+// Open opens the dead letter file at path for reading.
+func Open(path string) (*Reader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{f: f, dec: json.NewDecoder(bufio.NewReader(f)), path: path}, nil
+}
+
+// Next returns the next entry, or io.EOF after the last one.
+func (r *Reader) Next() (Entry, error) {
+	var e Entry
+	if !r.dec.More() {
+		return e, io.EOF
+	}
+	r.n++
+	if err := r.dec.Decode(&e); err != nil {
+		return e, fmt.Errorf("deadletter: %s entry %d: %w", r.path, r.n, err)
+	}
+	return e, nil
+}
+
+// Close closes the file.
+func (r *Reader) Close() error {
+	return r.f.Close()
+}
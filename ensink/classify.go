@@ -0,0 +1,91 @@
+/**
+ * (C) Copyright IBM Corp. 2022.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ensink
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Event-Notifications/push-en-migration-tool/iam"
+)
+
+// Category is the kind of failure of a request.
+type Category string
+
+const (
+	// CategoryValidation is a row EN rejects as invalid, or one that
+	// cannot be sent at all such as a device without a platform.
+	CategoryValidation Category = "validation"
+	// CategoryAuth is a rejected token or missing permission.
+	CategoryAuth Category = "auth"
+	// CategoryConflict is a device or subscription that already exists.
+	CategoryConflict Category = "conflict"
+	// CategoryThrottled is a 429 response.
+	CategoryThrottled Category = "throttled"
+	// CategoryServer is a 5xx response.
+	CategoryServer Category = "server"
+	// CategoryNetwork is a request that got no response.
+	CategoryNetwork Category = "network"
+	// CategoryOther is any other failure.
+	CategoryOther Category = "other"
+)
+
+// Categories lists every Category in reporting order.
+var Categories = []Category{
+	CategoryValidation, CategoryAuth, CategoryConflict, CategoryThrottled,
+	CategoryServer, CategoryNetwork, CategoryOther,
+}
+
+// Classify returns the Category of an error returned by a Client.
+func Classify(err error) Category {
+	var apiErr *APIError
+	var netErr *NetworkError
+	var iamErr *iam.Error
+	var iamNetErr *iam.NetworkError
+	switch {
+	case errors.As(err, &apiErr):
+		switch status := apiErr.StatusCode; {
+		case status == http.StatusUnauthorized || status == http.StatusForbidden:
+			return CategoryAuth
+		case status == http.StatusConflict:
+			return CategoryConflict
+		case status == http.StatusTooManyRequests:
+			return CategoryThrottled
+		case status >= 500:
+			return CategoryServer
+		case status >= 400:
+			return CategoryValidation
+		}
+	case errors.As(err, &netErr):
+		return CategoryNetwork
+	case errors.As(err, &iamErr):
+		// IAM failing to issue a token is not a problem of the
+		// credentials.
+		switch status := iamErr.StatusCode; {
+		case status == http.StatusTooManyRequests:
+			return CategoryThrottled
+		case status >= 500:
+			return CategoryServer
+		}
+		return CategoryAuth
+	case errors.As(err, &iamNetErr):
+		return CategoryNetwork
+	case errors.Is(err, ErrUnknownPlatform), errors.Is(err, ErrInvalidRow):
+		return CategoryValidation
+	}
+	return CategoryOther
+}
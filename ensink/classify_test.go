@@ -0,0 +1,86 @@
+/**
+ * (C) Copyright IBM Corp. 2022.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ensink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Event-Notifications/push-en-migration-tool/iam"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		err       error
+		category  Category
+		retriable bool
+	}{
+		{&APIError{StatusCode: 400}, CategoryValidation, false},
+		{&APIError{StatusCode: 403}, CategoryAuth, false},
+		{&APIError{StatusCode: 409}, CategoryConflict, false},
+		{&APIError{StatusCode: 429}, CategoryThrottled, true},
+		{&APIError{StatusCode: 503}, CategoryServer, true},
+		{&NetworkError{Err: errors.New("reset")}, CategoryNetwork, true},
+		{fmt.Errorf("%w: %w", iam.ErrCredentialsInvalid, &APIError{StatusCode: 401}), CategoryAuth, false},
+		{&iam.Error{StatusCode: 400}, CategoryAuth, false},
+		{&iam.Error{StatusCode: 401}, CategoryAuth, false},
+		{&iam.Error{StatusCode: 429}, CategoryThrottled, true},
+		{&iam.Error{StatusCode: 500}, CategoryServer, true},
+		{&iam.Error{StatusCode: 503}, CategoryServer, true},
+		{&iam.NetworkError{Err: errors.New("reset")}, CategoryNetwork, true},
+		{fmt.Errorf("%w: no platform", ErrUnknownPlatform), CategoryValidation, false},
+		{fmt.Errorf("%w: 1 fields, want 4", ErrInvalidRow), CategoryValidation, false},
+		{errors.New("other"), CategoryOther, false},
+	}
+	for _, tt := range tests {
+		if got := Classify(tt.err); got != tt.category {
+			t.Errorf("Classify(%v) = %s, want %s", tt.err, got, tt.category)
+		}
+		if got := Retriable(tt.err); got != tt.retriable {
+			t.Errorf("Retriable(%v) = %t, want %t", tt.err, got, tt.retriable)
+		}
+	}
+}
+
+// failingRefresh issues a token but fails to refresh it.
+type failingRefresh struct{ err error }
+
+func (f failingRefresh) Token(context.Context) (string, error)   { return "stale", nil }
+func (f failingRefresh) Refresh(context.Context) (string, error) { return "", f.err }
+
+func TestPostRefreshDuringIAMOutage(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.URL+"/instances/", "instance", failingRefresh{&iam.Error{StatusCode: http.StatusServiceUnavailable}})
+	err := c.RegisterDevice(context.Background(), "destination", Device{DeviceID: "d1"})
+	if err == nil {
+		t.Fatal("RegisterDevice() succeeded")
+	}
+	if errors.Is(err, iam.ErrCredentialsInvalid) {
+		t.Errorf("IAM outage %v matches iam.ErrCredentialsInvalid", err)
+	}
+	if got := Classify(err); got != CategoryServer || !Retriable(err) {
+		t.Errorf("IAM outage %v is %s, retriable %t; want server, retriable", err, got, Retriable(err))
+	}
+}
@@ -0,0 +1,238 @@
+/**
+ * (C) Copyright IBM Corp. 2022.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package ensink registers devices and tag subscriptions on the push
+// destinations of an IBM Event Notifications instance.
+package ensink
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/Event-Notifications/push-en-migration-tool/iam"
+)
+
+// Push platforms as exported by Push Notifications.
+const (
+	PlatformAPNs = "A"
+	PlatformFCM  = "G"
+)
+
+var (
+	// ErrConflict matches an APIError for a device or subscription that
+	// already exists.
+	ErrConflict = errors.New("ensink: already exists")
+	// ErrUnknownPlatform is returned for a device whose platform has no
+	// destination.
+	ErrUnknownPlatform = errors.New("ensink: unknown platform")
+	// ErrInvalidRow matches the error of an exported row that cannot be
+	// sent, such as one missing fields.
+	ErrInvalidRow = errors.New("ensink: invalid row")
+)
+
+// APIError is returned when EN answers with an unexpected status code.
+type APIError struct {
+	// Method is the method of the request, POST if empty.
+	Method     string
+	URL        string
+	StatusCode int
+	Body       string
+	// Attempts is the number of requests made, including retries.
+	Attempts int
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("ensink: %s %s returned status %d: %s", cmp.Or(e.Method, "POST"), e.URL, e.StatusCode, e.Body)
+}
+
+// Is reports a 409 response as ErrConflict.
+func (e *APIError) Is(target error) bool {
+	return target == ErrConflict && e.StatusCode == http.StatusConflict
+}
+
+// Device is a device to register on a destination.
+type Device struct {
+	DeviceID string `json:"device_id"`
+	UserID   string `json:"user_id"`
+	Token    string `json:"token"`
+	Platform string `json:"platform"`
+}
+
+// Destinations holds the IDs of the EN push destinations.
+type Destinations struct {
+	IOS     string
+	Android string
+}
+
+// ForPlatform returns the destination ID for a Push platform.
+func (d Destinations) ForPlatform(platform string) (string, error) {
+	switch platform {
+	case PlatformAPNs:
+		return d.IOS, nil
+	case PlatformFCM:
+		return d.Android, nil
+	}
+	return "", fmt.Errorf("%w %q", ErrUnknownPlatform, platform)
+}
+
+// RateLimiter delays requests to stay within an API quota.
+type RateLimiter interface {
+	Wait(ctx context.Context) error
+}
+
+// Client writes to a single EN instance.
+type Client struct {
+	// BaseURL is the regional instances endpoint, ending in "/instances/".
+	BaseURL    string
+	InstanceID string
+	Tokens     iam.TokenSource
+	HTTPClient *http.Client
+	// RateLimiter, if set, is waited on before every request.
+	RateLimiter RateLimiter
+	// Retry is applied to requests failing with a retriable error.
+	Retry RetryPolicy
+}
+
+// NewClient returns a Client for the EN instance instanceID using
+// DefaultRetryPolicy.
+func NewClient(baseURL, instanceID string, tokens iam.TokenSource) *Client {
+	return &Client{BaseURL: baseURL, InstanceID: instanceID, Tokens: tokens, Retry: DefaultRetryPolicy}
+}
+
+// DestinationURL returns the URL of a destination sub-resource.
+func (c *Client) DestinationURL(destinationID, resource string) string {
+	return c.BaseURL + c.InstanceID + "/destinations/" + destinationID + "/" + resource
+}
+
+// RegisterDevice registers d on the destination destinationID.
+func (c *Client) RegisterDevice(ctx context.Context, destinationID string, d Device) error {
+	return c.post(ctx, c.DestinationURL(destinationID, "devices"), d)
+}
+
+// SubscribeTag subscribes the device deviceID to tagName on the destination
+// destinationID.
+func (c *Client) SubscribeTag(ctx context.Context, destinationID, deviceID, tagName string) error {
+	return c.post(ctx, c.DestinationURL(destinationID, "tag_subscriptions"), map[string]string{
+		"device_id": deviceID,
+		"tag_name":  tagName,
+	})
+}
+
+// post sends payload to url, retrying network errors, 429 and 5xx
+// responses according to c.Retry. A Retry-After header on a 429 or 503
+// response takes precedence over the backoff. A 401 response is retried
+// once with a new token; a second one fails with iam.ErrCredentialsInvalid.
+func (c *Client) post(ctx context.Context, url string, payload any) error {
+	postBody, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	refresh := false
+	reauthenticated := false
+	attempts := 0
+	for {
+		var token string
+		if refresh {
+			token, err = c.Tokens.Refresh(ctx)
+		} else {
+			token, err = c.Tokens.Token(ctx)
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+
+		if c.RateLimiter != nil {
+			if err := c.RateLimiter.Wait(ctx); err != nil {
+				return err
+			}
+		}
+
+		req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(postBody))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+
+		attempts++
+		var delay time.Duration
+		var failure error
+
+		resp, err := c.httpClient().Do(req)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			failure = &NetworkError{URL: url, Attempts: attempts, Err: err}
+			delay = c.Retry.backoff(attempts)
+		} else {
+			body, err := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err != nil {
+				return err
+			}
+
+			refresh = resp.StatusCode == http.StatusUnauthorized
+			switch {
+			case refresh && reauthenticated:
+				return fmt.Errorf("%w: %w", iam.ErrCredentialsInvalid,
+					&APIError{URL: url, StatusCode: resp.StatusCode, Body: string(body), Attempts: attempts})
+			case refresh:
+				// A stale token is not a failed attempt, but it is only
+				// replaced once.
+				reauthenticated = true
+				attempts--
+				continue
+			case resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusCreated:
+				return nil
+			}
+
+			failure = &APIError{URL: url, StatusCode: resp.StatusCode, Body: string(body), Attempts: attempts}
+			if !retriableStatus(resp.StatusCode) {
+				return failure
+			}
+			var ok bool
+			if delay, ok = retryAfter(resp); !ok {
+				delay = c.Retry.backoff(attempts)
+			}
+		}
+
+		if attempts >= c.Retry.MaxAttempts {
+			return failure
+		}
+		if err := sleep(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
@@ -0,0 +1,149 @@
+/**
+ * (C) Copyright IBM Corp. 2022.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ensink
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/Event-Notifications/push-en-migration-tool/iam"
+)
+
+// Types of the EN push destinations devices are migrated to.
+const (
+	DestinationTypeIOS     = "push_ios"
+	DestinationTypeAndroid = "push_android"
+)
+
+// Destination is a destination of an EN instance.
+type Destination struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Type        string `json:"type"`
+}
+
+// DestinationList is one page of the destinations of an instance.
+type DestinationList struct {
+	TotalCount   int           `json:"total_count"`
+	Offset       int           `json:"offset"`
+	Limit        int           `json:"limit"`
+	Destinations []Destination `json:"destinations"`
+}
+
+// ListDestinations returns the first limit destinations of the instance.
+// It fails with a 404 APIError if the instance does not exist.
+func (c *Client) ListDestinations(ctx context.Context, limit int) (*DestinationList, error) {
+	var list DestinationList
+	u := c.BaseURL + c.InstanceID + "/destinations?" + url.Values{"limit": {fmt.Sprint(limit)}}.Encode()
+	if err := c.get(ctx, u, &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// GetDestination returns the destination destinationID.
+func (c *Client) GetDestination(ctx context.Context, destinationID string) (*Destination, error) {
+	var d Destination
+	if err := c.get(ctx, c.BaseURL+c.InstanceID+"/destinations/"+destinationID, &d); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// WriteProbeDeviceID is the ID of the invalid device posted by CheckWrite.
+const WriteProbeDeviceID = "push-en-migrate-write-check"
+
+// CheckWrite reports whether the credentials of c may register devices on
+// the destination destinationID without registering one: it posts the
+// device WriteProbeDeviceID without token or platform. This relies on EN
+// authorizing a request before validating it, so that the invalid device
+// is rejected with 400 when writing is allowed and with 401 or 403 when it
+// is not. Should EN accept the device, an error naming it is returned so
+// that it can be deleted.
+func (c *Client) CheckWrite(ctx context.Context, destinationID string) error {
+	err := c.RegisterDevice(ctx, destinationID, Device{DeviceID: WriteProbeDeviceID})
+	var apiErr *APIError
+	switch {
+	case err == nil:
+		return fmt.Errorf("ensink: EN registered the invalid device %s on destination %s instead of rejecting it, delete it and check the write permission in IAM",
+			WriteProbeDeviceID, destinationID)
+	case errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusBadRequest:
+		return nil
+	}
+	return err
+}
+
+// get fetches url into v. Unlike writes it is not retried, other than once
+// with a new token on a 401 response.
+func (c *Client) get(ctx context.Context, url string, v any) error {
+	refresh := false
+	for {
+		var token string
+		var err error
+		if refresh {
+			token, err = c.Tokens.Refresh(ctx)
+		} else {
+			token, err = c.Tokens.Token(ctx)
+		}
+		if err != nil {
+			return err
+		}
+		if c.RateLimiter != nil {
+			if err := c.RateLimiter.Wait(ctx); err != nil {
+				return err
+			}
+		}
+
+		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Accept", "application/json")
+
+		resp, err := c.httpClient().Do(req)
+		if err != nil {
+			return fmt.Errorf("ensink: GET %s: %w", url, err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case resp.StatusCode == http.StatusUnauthorized && !refresh:
+			refresh = true
+			continue
+		case resp.StatusCode == http.StatusUnauthorized:
+			return fmt.Errorf("%w: %w", iam.ErrCredentialsInvalid,
+				&APIError{Method: "GET", URL: url, StatusCode: resp.StatusCode, Body: string(body), Attempts: 1})
+		case resp.StatusCode != http.StatusOK:
+			return &APIError{Method: "GET", URL: url, StatusCode: resp.StatusCode, Body: string(body), Attempts: 1}
+		}
+		if err := json.Unmarshal(body, v); err != nil {
+			return fmt.Errorf("ensink: decoding %s: %w", url, err)
+		}
+		return nil
+	}
+}
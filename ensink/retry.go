@@ -0,0 +1,148 @@
+/**
+ * (C) Copyright IBM Corp. 2022.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ensink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Event-Notifications/push-en-migration-tool/iam"
+)
+
+// RetryPolicy decides how often and how long after a failed request it is
+// tried again.
+type RetryPolicy struct {
+	// MaxAttempts is the number of times a request is made, including
+	// the first. Zero or one disables retries.
+	MaxAttempts int
+	// BaseDelay is the backoff before the first retry. It doubles with
+	// every attempt up to MaxDelay, and a random delay between zero and
+	// that backoff is used.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// DefaultRetryPolicy is the RetryPolicy of clients created by NewClient.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 5,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    30 * time.Second,
+}
+
+// backoff returns the delay after the given failed attempt, starting at 1.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	ceiling := p.MaxDelay
+	if shift := attempt - 1; shift < 32 {
+		ceiling = min(p.BaseDelay<<shift, p.MaxDelay)
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return rand.N(ceiling + 1)
+}
+
+// NetworkError is returned when a request fails without a response.
+type NetworkError struct {
+	URL      string
+	Attempts int
+	Err      error
+}
+
+func (e *NetworkError) Error() string {
+	return fmt.Sprintf("ensink: POST %s failed after %d attempts: %v", e.URL, e.Attempts, e.Err)
+}
+
+func (e *NetworkError) Unwrap() error { return e.Err }
+
+// Retriable reports whether err is a failure that may succeed if the
+// request is made again later: a network error, a 429 or a 5xx response,
+// from EN or from IAM while fetching a token. Credentials IAM rejects are
+// not.
+func Retriable(err error) bool {
+	var netErr *NetworkError
+	var iamNetErr *iam.NetworkError
+	if errors.As(err, &netErr) || errors.As(err, &iamNetErr) {
+		return true
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return retriableStatus(apiErr.StatusCode)
+	}
+	var iamErr *iam.Error
+	if errors.As(err, &iamErr) {
+		return iamErr.StatusCode == http.StatusTooManyRequests || iamErr.StatusCode >= 500
+	}
+	return false
+}
+
+// Attempts returns the number of requests made before err was returned, or
+// zero if err did not come from a request.
+func Attempts(err error) int {
+	var netErr *NetworkError
+	if errors.As(err, &netErr) {
+		return netErr.Attempts
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Attempts
+	}
+	return 0
+}
+
+func retriableStatus(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryAfter parses the Retry-After header of a 429 or 503 response, given
+// either in seconds or as an HTTP date.
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+		return 0, false
+	}
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(time.Until(t), 0), true
+	}
+	return 0, false
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
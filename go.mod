@@ -0,0 +1,3 @@
+module github.com/Event-Notifications/push-en-migration-tool
+
+go 1.24
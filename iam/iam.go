@@ -0,0 +1,319 @@
+/**
+ * (C) Copyright IBM Corp. 2022.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package iam obtains IBM Cloud IAM access tokens for the Push and Event
+// Notifications clients.
+package iam
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// IAM token endpoints.
+const (
+	// DefaultURL is the public IAM token endpoint.
+	DefaultURL = "https://iam.cloud.ibm.com/identity/token"
+	// PrivateURL is the token endpoint reachable over the IBM Cloud
+	// private network.
+	PrivateURL = "https://private.iam.cloud.ibm.com/identity/token"
+	// TestURL is the token endpoint of the IBM Cloud test environment.
+	TestURL = "https://iam.test.cloud.ibm.com/identity/token"
+)
+
+// TokenPath is the path of the token endpoint on an IAM host.
+const TokenPath = "/identity/token"
+
+// TokenSource supplies access tokens to API clients.
+type TokenSource interface {
+	// Token returns the current access token, fetching one if needed.
+	Token(ctx context.Context) (string, error)
+	// Refresh discards the current token and fetches a new one.
+	Refresh(ctx context.Context) (string, error)
+}
+
+// ErrCredentialsInvalid is matched by the error of a request rejected
+// because of its credentials: an API key IAM does not accept, or a service
+// answering 401 to a token just issued. Retrying such a request cannot
+// succeed, so a migration stops on it.
+var ErrCredentialsInvalid = errors.New("iam: credentials invalid")
+
+// Error is returned when IAM rejects a token request.
+type Error struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("iam: token request failed with status %d: %s", e.StatusCode, e.Body)
+}
+
+// Is reports a rejected API key as ErrCredentialsInvalid.
+func (e *Error) Is(target error) bool {
+	return target == ErrCredentialsInvalid &&
+		(e.StatusCode == http.StatusBadRequest || e.StatusCode == http.StatusUnauthorized)
+}
+
+// NetworkError is returned when a token request gets no response from IAM.
+type NetworkError struct {
+	Err error
+}
+
+func (e *NetworkError) Error() string {
+	return "iam: failed to get authorization token: " + e.Err.Error()
+}
+
+func (e *NetworkError) Unwrap() error { return e.Err }
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	// ExpiresIn is the lifetime of the token in seconds.
+	ExpiresIn int64 `json:"expires_in"`
+	// Expiration is the Unix time at which the token expires.
+	Expiration int64 `json:"expiration"`
+}
+
+const (
+	// refreshFraction is the part of its lifetime after which a token is
+	// replaced ahead of its expiry.
+	refreshFraction = 0.8
+	// minRefreshInterval is how recent a token must be for Refresh to
+	// return it instead of fetching another one, so that workers rejected
+	// with the same stale token refresh it only once.
+	minRefreshInterval = 5 * time.Second
+	// requestTimeout bounds a token request, which is shared by every
+	// caller waiting for it.
+	requestTimeout = 30 * time.Second
+)
+
+// DefaultCRTokenFile is where IKS mounts the compute resource token of a
+// pod.
+const DefaultCRTokenFile = "/var/run/secrets/tokens/vault-token"
+
+// Authenticator exchanges an API key, or the compute resource token of a
+// trusted profile, for access tokens. It caches the token until most of its
+// lifetime has passed and then replaces it before it expires. Concurrent
+// requests for a new token are coalesced into one call to IAM. It is safe
+// for concurrent use.
+type Authenticator struct {
+	APIKey string
+	// ProfileID, when set, authenticates as that trusted profile with
+	// the compute resource token in CRTokenFile instead of APIKey. The
+	// file is read for every token request since it is rotated in place.
+	ProfileID   string
+	CRTokenFile string
+	URL         string
+	HTTPClient  *http.Client
+
+	mu        sync.Mutex
+	token     string
+	fetched   time.Time
+	refreshAt time.Time
+	expiresAt time.Time
+	inflight  *tokenCall
+}
+
+// tokenCall is a token request that callers wait on together.
+type tokenCall struct {
+	done  chan struct{}
+	token string
+	err   error
+}
+
+// NewAuthenticator returns an Authenticator for apiKey using DefaultURL.
+func NewAuthenticator(apiKey string) *Authenticator {
+	return &Authenticator{APIKey: apiKey, URL: DefaultURL}
+}
+
+// NewTrustedProfileAuthenticator returns an Authenticator for the trusted
+// profile profileID using the compute resource token in crTokenFile, or in
+// DefaultCRTokenFile if it is empty, and DefaultURL.
+func NewTrustedProfileAuthenticator(profileID, crTokenFile string) *Authenticator {
+	if crTokenFile == "" {
+		crTokenFile = DefaultCRTokenFile
+	}
+	return &Authenticator{ProfileID: profileID, CRTokenFile: crTokenFile, URL: DefaultURL}
+}
+
+// Token implements TokenSource. A token past its refresh time is replaced,
+// but is still returned if IAM fails before it expires.
+func (a *Authenticator) Token(ctx context.Context) (string, error) {
+	a.mu.Lock()
+	token, refreshAt, expiresAt := a.token, a.refreshAt, a.expiresAt
+	a.mu.Unlock()
+
+	now := time.Now()
+	switch {
+	case token == "":
+		return a.fetch(ctx, false)
+	case refreshAt.IsZero() || now.Before(refreshAt):
+		return token, nil
+	}
+	fresh, err := a.fetch(ctx, false)
+	if err != nil && now.Before(expiresAt) && ctx.Err() == nil {
+		return token, nil
+	}
+	return fresh, err
+}
+
+// Refresh implements TokenSource. A token fetched in the last few seconds
+// is returned as is.
+func (a *Authenticator) Refresh(ctx context.Context) (string, error) {
+	return a.fetch(ctx, true)
+}
+
+// fetch requests a new token, or joins the request in flight. Unless
+// force is set, a token that is not due for refresh is returned instead.
+func (a *Authenticator) fetch(ctx context.Context, force bool) (string, error) {
+	a.mu.Lock()
+	now := time.Now()
+	switch {
+	case a.token == "":
+	case force && now.Sub(a.fetched) < minRefreshInterval,
+		!force && (a.refreshAt.IsZero() || now.Before(a.refreshAt)):
+		token := a.token
+		a.mu.Unlock()
+		return token, nil
+	}
+	call := a.inflight
+	if call == nil {
+		call = &tokenCall{done: make(chan struct{})}
+		a.inflight = call
+		go a.run(ctx, call)
+	}
+	a.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.token, call.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// run performs call and stores its token. It is not cancelled with ctx
+// since other callers may be waiting for it.
+func (a *Authenticator) run(ctx context.Context, call *tokenCall) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), requestTimeout)
+	defer cancel()
+
+	start := time.Now()
+	result, err := a.requestToken(ctx)
+
+	a.mu.Lock()
+	if err == nil {
+		a.token = result.AccessToken
+		a.fetched = start
+		a.refreshAt, a.expiresAt = result.lifetime(start)
+		call.token = result.AccessToken
+	}
+	call.err = err
+	a.inflight = nil
+	a.mu.Unlock()
+	close(call.done)
+}
+
+// lifetime returns when a token issued at start is due for refresh and
+// when it expires, both zero if IAM did not say. expires_in is preferred
+// over expiration since it does not depend on the clocks agreeing.
+func (r *tokenResponse) lifetime(start time.Time) (refreshAt, expiresAt time.Time) {
+	switch {
+	case r.ExpiresIn > 0:
+		expiresAt = start.Add(time.Duration(r.ExpiresIn) * time.Second)
+	case r.Expiration > 0:
+		expiresAt = time.Unix(r.Expiration, 0)
+	default:
+		return time.Time{}, time.Time{}
+	}
+	lifetime := expiresAt.Sub(start)
+	return start.Add(time.Duration(float64(lifetime) * refreshFraction)), expiresAt
+}
+
+// grant returns the form of a token request.
+func (a *Authenticator) grant() (url.Values, error) {
+	data := url.Values{}
+	if a.ProfileID == "" {
+		data.Set("grant_type", "urn:ibm:params:oauth:grant-type:apikey")
+		data.Set("apikey", a.APIKey)
+		return data, nil
+	}
+
+	crToken, err := os.ReadFile(a.CRTokenFile)
+	if err != nil {
+		return nil, fmt.Errorf("iam: failed to read compute resource token: %w", err)
+	}
+	if len(bytes.TrimSpace(crToken)) == 0 {
+		return nil, fmt.Errorf("iam: compute resource token file %s is empty", a.CRTokenFile)
+	}
+	data.Set("grant_type", "urn:ibm:params:oauth:grant-type:cr-token")
+	data.Set("cr_token", string(bytes.TrimSpace(crToken)))
+	data.Set("profile_id", a.ProfileID)
+	return data, nil
+}
+
+func (a *Authenticator) requestToken(ctx context.Context) (*tokenResponse, error) {
+	data, err := a.grant()
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", a.URL, strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Add("Accept", "application/json")
+
+	resp, err := a.httpClient().Do(req)
+	if err != nil {
+		return nil, &NetworkError{Err: err}
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, &Error{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	var result tokenResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("iam: failed to decode token response: %w", err)
+	}
+	if result.AccessToken == "" {
+		return nil, fmt.Errorf("iam: token response has no access_token")
+	}
+	return &result, nil
+}
+
+func (a *Authenticator) httpClient() *http.Client {
+	if a.HTTPClient != nil {
+		return a.HTTPClient
+	}
+	return http.DefaultClient
+}
@@ -0,0 +1,210 @@
+/**
+ * (C) Copyright IBM Corp. 2022.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package iam
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeIAM is a token endpoint counting its calls. It answers with status
+// if set, and otherwise issues the token "tN" on its Nth call, valid for
+// expiresIn seconds.
+type fakeIAM struct {
+	*httptest.Server
+	calls     atomic.Int32
+	status    atomic.Int32
+	expiresIn int64
+	// delay keeps requests in flight long enough to be joined.
+	delay time.Duration
+}
+
+func newFakeIAM(t *testing.T) *fakeIAM {
+	f := &fakeIAM{expiresIn: 3600, delay: 50 * time.Millisecond}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := f.calls.Add(1)
+		time.Sleep(f.delay)
+		if status := int(f.status.Load()); status != 0 {
+			http.Error(w, `{"errorCode":"BXNIM0415E"}`, status)
+			return
+		}
+		fmt.Fprintf(w, `{"access_token":"t%d","expires_in":%d}`, n, f.expiresIn)
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeIAM) authenticator() *Authenticator {
+	return &Authenticator{APIKey: "key", URL: f.URL}
+}
+
+// concurrently calls fn from n goroutines and returns the tokens they got.
+func concurrently(t *testing.T, n int, fn func(context.Context) (string, error)) []string {
+	t.Helper()
+	tokens := make([]string, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tokens[i], errs[i] = fn(context.Background())
+		}()
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		t.Fatal(err)
+	}
+	return tokens
+}
+
+func TestTokenCoalescesRequests(t *testing.T) {
+	f := newFakeIAM(t)
+	a := f.authenticator()
+
+	for _, token := range concurrently(t, 50, a.Token) {
+		if token != "t1" {
+			t.Errorf("Token() = %q, want t1", token)
+		}
+	}
+	if got := f.calls.Load(); got != 1 {
+		t.Errorf("50 concurrent Token calls made %d IAM requests, want 1", got)
+	}
+
+	// The cached token is returned until it is due for refresh.
+	if token, err := a.Token(context.Background()); err != nil || token != "t1" {
+		t.Errorf("Token() = %q, %v, want t1", token, err)
+	}
+	if got := f.calls.Load(); got != 1 {
+		t.Errorf("cached Token made %d IAM requests, want 1", got)
+	}
+}
+
+func TestRefreshCoalescesRequests(t *testing.T) {
+	f := newFakeIAM(t)
+	a := f.authenticator()
+	if _, err := a.Token(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Workers rejected with a token fetched moments ago share it.
+	for _, token := range concurrently(t, 20, a.Refresh) {
+		if token != "t1" {
+			t.Errorf("Refresh() of a recent token = %q, want t1", token)
+		}
+	}
+	if got := f.calls.Load(); got != 1 {
+		t.Errorf("Refresh of a recent token made %d IAM requests, want 1", got)
+	}
+
+	a.mu.Lock()
+	a.fetched = time.Now().Add(-2 * minRefreshInterval)
+	a.mu.Unlock()
+	var tokens []string
+	tokens = append(tokens, concurrently(t, 20, a.Refresh)...)
+	tokens = append(tokens, concurrently(t, 20, a.Token)...)
+	for _, token := range tokens {
+		if token != "t2" {
+			t.Errorf("token after Refresh = %q, want t2", token)
+		}
+	}
+	if got := f.calls.Load(); got != 2 {
+		t.Errorf("concurrent Refresh made %d IAM requests in all, want 2", got)
+	}
+}
+
+func TestTokenKeepsTokenWhileIAMFails(t *testing.T) {
+	f := newFakeIAM(t)
+	f.delay = 0
+	a := f.authenticator()
+	if _, err := a.Token(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Due for refresh but not expired: the old token is still used.
+	f.status.Store(http.StatusServiceUnavailable)
+	a.mu.Lock()
+	a.refreshAt = time.Now().Add(-time.Minute)
+	a.mu.Unlock()
+	if token, err := a.Token(context.Background()); err != nil || token != "t1" {
+		t.Errorf("Token() with IAM down before expiry = %q, %v, want t1", token, err)
+	}
+
+	// Once expired the failure is returned.
+	a.mu.Lock()
+	a.expiresAt = time.Now().Add(-time.Second)
+	a.mu.Unlock()
+	_, err := a.Token(context.Background())
+	var iamErr *Error
+	if !errors.As(err, &iamErr) || iamErr.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Token() with IAM down after expiry = %v, want a 503 *Error", err)
+	}
+	if errors.Is(err, ErrCredentialsInvalid) {
+		t.Errorf("IAM being down %v matches ErrCredentialsInvalid", err)
+	}
+
+	// IAM coming back replaces the expired token.
+	f.status.Store(0)
+	if token, err := a.Token(context.Background()); err != nil || token != "t4" {
+		t.Errorf("Token() after IAM recovered = %q, %v, want t4", token, err)
+	}
+}
+
+func TestTokenErrors(t *testing.T) {
+	f := newFakeIAM(t)
+	f.delay = 0
+	f.status.Store(http.StatusBadRequest)
+	_, err := f.authenticator().Token(context.Background())
+	if !errors.Is(err, ErrCredentialsInvalid) {
+		t.Errorf("Token() with a rejected API key = %v, want ErrCredentialsInvalid", err)
+	}
+
+	f.Close()
+	_, err = f.authenticator().Token(context.Background())
+	var netErr *NetworkError
+	if !errors.As(err, &netErr) {
+		t.Errorf("Token() with IAM unreachable = %v, want a *NetworkError", err)
+	}
+}
+
+func TestLifetime(t *testing.T) {
+	start := time.Unix(1_700_000_000, 0)
+	tests := []struct {
+		name                 string
+		response             tokenResponse
+		refreshAt, expiresAt time.Time
+	}{
+		{"expires_in", tokenResponse{ExpiresIn: 3600}, start.Add(48 * time.Minute), start.Add(time.Hour)},
+		{"expiration", tokenResponse{Expiration: start.Unix() + 1000}, start.Add(800 * time.Second), start.Add(1000 * time.Second)},
+		// expires_in wins over a clock that disagrees.
+		{"both", tokenResponse{ExpiresIn: 3600, Expiration: start.Unix() + 60}, start.Add(48 * time.Minute), start.Add(time.Hour)},
+		{"neither", tokenResponse{}, time.Time{}, time.Time{}},
+	}
+	for _, tt := range tests {
+		refreshAt, expiresAt := tt.response.lifetime(start)
+		if !refreshAt.Equal(tt.refreshAt) || !expiresAt.Equal(tt.expiresAt) {
+			t.Errorf("%s: lifetime() = %v, %v, want %v, %v", tt.name, refreshAt, expiresAt, tt.refreshAt, tt.expiresAt)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+/**
+ * (C) Copyright IBM Corp. 2022.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package journal records the progress of imports and exports so that an
+// interrupted run can be resumed without repeating completed work.
+//
+// A Journal tracks the completed rows of an import. It is an append-only
+// file with one CSV record per completed key. Every entry is written to the
+// file as soon as it is recorded, so entries survive the process being
+// killed. A torn final line left by a crash is discarded when the journal
+// is reopened.
+//
+// A Checkpoint tracks the last page written by an export.
+package journal
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Journal is a set of completed keys backed by an append-only file. Only
+// the keys of a previous run are held in memory, as a 128-bit digest each so
+// that resuming a large import needs a fixed amount of memory per key. Those
+// recorded since Open are written to the file alone. It is safe for
+// concurrent use.
+type Journal struct {
+	mu   sync.Mutex
+	f    *os.File
+	done map[digest]struct{}
+}
+
+// digest identifies a key by the first 128 bits of its SHA-256 hash, so
+// that two keys are not expected to share one in any journal.
+type digest [16]byte
+
+// Open opens the journal at path, creating it if needed. When resume is
+// false any existing entries are discarded.
+func Open(path string, resume bool) (*Journal, error) {
+	flags := os.O_CREATE | os.O_RDWR
+	if !resume {
+		flags |= os.O_TRUNC
+	}
+	f, err := os.OpenFile(path, flags, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	j := &Journal{f: f, done: make(map[digest]struct{})}
+	if err := j.load(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("journal: reading %s: %w", path, err)
+	}
+	return j, nil
+}
+
+// load reads the completed keys and truncates a torn final line.
+func (j *Journal) load() error {
+	var valid int64
+	r := bufio.NewReader(j.f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		fields, err := csv.NewReader(bytes.NewReader(line)).Read()
+		if err != nil {
+			return err
+		}
+		j.done[keyDigest(fields)] = struct{}{}
+		valid += int64(len(line))
+	}
+	if err := j.f.Truncate(valid); err != nil {
+		return err
+	}
+	_, err := j.f.Seek(valid, io.SeekStart)
+	return err
+}
+
+// Len returns the number of keys completed before Open.
+func (j *Journal) Len() int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return len(j.done)
+}
+
+// Done reports whether key was recorded before Open.
+func (j *Journal) Done(key ...string) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	_, ok := j.done[keyDigest(key)]
+	return ok
+}
+
+// Record appends key to the file. It is not added to the keys of Done,
+// since every row is imported once per run.
+func (j *Journal) Record(key ...string) error {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.Write(key); err != nil {
+		return err
+	}
+	w.Flush()
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	_, err := j.f.Write(buf.Bytes())
+	return err
+}
+
+// Sync commits the journal file to disk.
+func (j *Journal) Sync() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.f.Sync()
+}
+
+// Close syncs and closes the journal file.
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if err := j.f.Sync(); err != nil {
+		j.f.Close()
+		return err
+	}
+	return j.f.Close()
+}
+
+func keyDigest(fields []string) digest {
+	sum := sha256.Sum256([]byte(strings.Join(fields, "\x00")))
+	return digest(sum[:16])
+}
@@ -0,0 +1,128 @@
+/**
+ * (C) Copyright IBM Corp. 2022.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package journal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenTruncatesTornLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "devices.journal")
+	if err := os.WriteFile(path, []byte("d1,A\nd2,G\nd3,"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	j, err := Open(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := j.Len(); got != 2 {
+		t.Errorf("Len() = %d, want 2", got)
+	}
+	if !j.Done("d1", "A") || !j.Done("d2", "G") {
+		t.Error("complete entries are not done")
+	}
+	if j.Done("d3", "") || j.Done("d3") {
+		t.Error("torn entry is done")
+	}
+	if err := j.Record("d3", "A"); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "d1,A\nd2,G\nd3,A\n"; string(b) != want {
+		t.Errorf("file = %q, want %q", b, want)
+	}
+}
+
+func TestReopenAfterRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "subscription.journal")
+	j, err := Open(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := [][]string{{"d1", "news"}, {"d1", "sport"}, {"d2", "tag,with \"quotes\""}}
+	for _, key := range keys {
+		if err := j.Record(key...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Keys recorded since Open are only kept in the file.
+	if got := j.Len(); got != 0 {
+		t.Errorf("Len() = %d before reopening, want 0", got)
+	}
+	if err := j.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	j, err = Open(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	if got := j.Len(); got != len(keys) {
+		t.Errorf("Len() = %d, want %d", got, len(keys))
+	}
+	for _, key := range keys {
+		if !j.Done(key...) {
+			t.Errorf("Done(%q) = false after reopening", key)
+		}
+	}
+	if j.Done("d2", "news") {
+		t.Error("unrecorded key is done")
+	}
+}
+
+func TestOpenWithoutResumeTruncates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "devices.journal")
+	if err := os.WriteFile(path, []byte("d1,A\nd2,G\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	j, err := Open(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := j.Len(); got != 0 {
+		t.Errorf("Len() = %d, want 0", got)
+	}
+	if j.Done("d1", "A") {
+		t.Error("entry of the previous run is done")
+	}
+	if err := j.Record("d3", "A"); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "d3,A\n"; string(b) != want {
+		t.Errorf("file = %q, want %q", b, want)
+	}
+}
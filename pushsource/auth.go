@@ -0,0 +1,88 @@
+/**
+ * (C) Copyright IBM Corp. 2022.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pushsource
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/Event-Notifications/push-en-migration-tool/iam"
+)
+
+// Auth authorizes the requests of a Client.
+type Auth interface {
+	// Authorize adds the credentials to req.
+	Authorize(ctx context.Context, req *http.Request) error
+	// Renew replaces credentials Push rejected with a 401. It returns
+	// false if they cannot be renewed.
+	Renew(ctx context.Context) (bool, error)
+}
+
+// IAMAuth authorizes requests with an IAM access token.
+type IAMAuth struct {
+	Tokens iam.TokenSource
+}
+
+// Authorize implements Auth.
+func (a IAMAuth) Authorize(ctx context.Context, req *http.Request) error {
+	token, err := a.Tokens.Token(ctx)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", token)
+	return nil
+}
+
+// Renew implements Auth by refreshing the token.
+func (a IAMAuth) Renew(ctx context.Context) (bool, error) {
+	_, err := a.Tokens.Refresh(ctx)
+	return err == nil, err
+}
+
+// ClientSecretAuth authorizes requests with the client secret of the Push
+// service credentials.
+type ClientSecretAuth struct {
+	Secret string
+}
+
+// Authorize implements Auth.
+func (a ClientSecretAuth) Authorize(ctx context.Context, req *http.Request) error {
+	req.Header.Set("clientSecret", a.Secret)
+	return nil
+}
+
+// Renew implements Auth. A client secret cannot be renewed.
+func (a ClientSecretAuth) Renew(ctx context.Context) (bool, error) {
+	return false, nil
+}
+
+// AppSecretAuth authorizes requests with the application secret of the
+// Push service credentials.
+type AppSecretAuth struct {
+	Secret string
+}
+
+// Authorize implements Auth.
+func (a AppSecretAuth) Authorize(ctx context.Context, req *http.Request) error {
+	req.Header.Set("appSecret", a.Secret)
+	return nil
+}
+
+// Renew implements Auth. An application secret cannot be renewed.
+func (a AppSecretAuth) Renew(ctx context.Context) (bool, error) {
+	return false, nil
+}
@@ -0,0 +1,206 @@
+/**
+ * (C) Copyright IBM Corp. 2022.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package pushsource reads devices and tag subscriptions from an IBM Push
+// Notifications instance.
+package pushsource
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/Event-Notifications/push-en-migration-tool/iam"
+)
+
+// DefaultPageSize is the number of items requested per page.
+const DefaultPageSize = 500
+
+// BroadcastTag is the implicit tag every Push device is subscribed to. It
+// has no counterpart in Event Notifications.
+const BroadcastTag = "Push.ALL"
+
+// Device is a device registered in a Push instance. Platform is "A" for
+// APNs and "G" for FCM.
+type Device struct {
+	DeviceID string `json:"deviceId"`
+	UserID   string `json:"userId"`
+	Token    string `json:"token"`
+	Platform string `json:"platform"`
+}
+
+// Subscription is a subscription of a device to a Push tag.
+type Subscription struct {
+	TagName  string `json:"tagName"`
+	DeviceID string `json:"deviceId"`
+}
+
+// PageInfo describes the position of a page in a listing.
+type PageInfo struct {
+	TotalCount int    `json:"totalCount"`
+	Next       string `json:"next"`
+}
+
+// DevicePage is one page of the device listing.
+type DevicePage struct {
+	PageInfo PageInfo `json:"pageInfo"`
+	Devices  []Device `json:"devices"`
+}
+
+// SubscriptionPage is one page of the subscription listing.
+type SubscriptionPage struct {
+	PageInfo      PageInfo       `json:"pageInfo"`
+	Subscriptions []Subscription `json:"subscriptions"`
+}
+
+// APIError is returned when Push answers with an unexpected status code.
+type APIError struct {
+	URL        string
+	StatusCode int
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("pushsource: GET %s returned status %d: %s", e.URL, e.StatusCode, e.Body)
+}
+
+// DecodeError is returned when a page cannot be decoded.
+type DecodeError struct {
+	URL  string
+	Body string
+	Err  error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("pushsource: decoding %s: %v (response %q)", e.URL, e.Err, e.Body)
+}
+
+func (e *DecodeError) Unwrap() error { return e.Err }
+
+// Client reads from a single Push application.
+type Client struct {
+	// BaseURL is the regional apps endpoint, ending in "/apps/".
+	BaseURL string
+	AppID   string
+
+	// Auth authorizes device and subscription listings.
+	Auth Auth
+
+	HTTPClient *http.Client
+	PageSize   int
+}
+
+// NewClient returns a Client for the Push application appID authorized by
+// auth, usually an IAMAuth.
+func NewClient(baseURL, appID string, auth Auth) *Client {
+	return &Client{BaseURL: baseURL, AppID: appID, Auth: auth, PageSize: DefaultPageSize}
+}
+
+// DevicesURL returns the URL of the device page starting at offset.
+func (c *Client) DevicesURL(offset int) string {
+	return c.listURL("devices", offset)
+}
+
+// SubscriptionsURL returns the URL of the subscription page starting at
+// offset.
+func (c *Client) SubscriptionsURL(offset int) string {
+	return c.listURL("subscriptions", offset)
+}
+
+func (c *Client) listURL(resource string, offset int) string {
+	size := c.PageSize
+	if size <= 0 {
+		size = DefaultPageSize
+	}
+	return c.BaseURL + c.AppID + "/" + resource + "?expand=true&offset=" +
+		strconv.Itoa(offset) + "&size=" + strconv.Itoa(size)
+}
+
+// GetDevicePage fetches the device page at pageURL.
+func (c *Client) GetDevicePage(ctx context.Context, pageURL string) (*DevicePage, error) {
+	var page DevicePage
+	if err := c.get(ctx, pageURL, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// GetSubscriptionPage fetches the subscription page at pageURL.
+func (c *Client) GetSubscriptionPage(ctx context.Context, pageURL string) (*SubscriptionPage, error) {
+	var page SubscriptionPage
+	if err := c.get(ctx, pageURL, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// get fetches pageURL into v. A 401 response is retried once with renewed
+// credentials and otherwise fails with iam.ErrCredentialsInvalid.
+func (c *Client) get(ctx context.Context, pageURL string, v any) error {
+	renewed := false
+	for {
+		req, err := http.NewRequestWithContext(ctx, "GET", pageURL, nil)
+		if err != nil {
+			return err
+		}
+		if err := c.Auth.Authorize(ctx, req); err != nil {
+			return err
+		}
+
+		resp, err := c.httpClient().Do(req)
+		if err != nil {
+			return err
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		if resp.StatusCode == http.StatusUnauthorized {
+			apiErr := &APIError{URL: pageURL, StatusCode: resp.StatusCode, Body: string(body)}
+			if renewed {
+				return fmt.Errorf("%w: %w", iam.ErrCredentialsInvalid, apiErr)
+			}
+			ok, err := c.Auth.Renew(ctx)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return fmt.Errorf("%w: %w", iam.ErrCredentialsInvalid, apiErr)
+			}
+			renewed = true
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			return &APIError{URL: pageURL, StatusCode: resp.StatusCode, Body: string(body)}
+		}
+		if err := json.Unmarshal(body, v); err != nil {
+			return &DecodeError{URL: pageURL, Body: string(body), Err: err}
+		}
+		return nil
+	}
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
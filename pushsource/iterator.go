@@ -0,0 +1,110 @@
+/**
+ * (C) Copyright IBM Corp. 2022.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pushsource
+
+import "context"
+
+// pager walks a listing page by page, following PageInfo.Next.
+type pager[T any] struct {
+	ctx   context.Context
+	fetch func(ctx context.Context, pageURL string) ([]T, PageInfo, error)
+
+	next  string
+	items []T
+	cur   T
+	err   error
+}
+
+func (p *pager[T]) advance() bool {
+	for len(p.items) == 0 {
+		if p.err != nil || p.next == "" {
+			return false
+		}
+		items, info, err := p.fetch(p.ctx, p.next)
+		if err != nil {
+			p.err = err
+			return false
+		}
+		p.items = items
+		p.next = info.Next
+	}
+	p.cur = p.items[0]
+	p.items = p.items[1:]
+	return true
+}
+
+// DeviceIterator iterates over every device of a Push application.
+type DeviceIterator struct {
+	p pager[Device]
+}
+
+// Devices returns an iterator over every device of the application.
+func (c *Client) Devices(ctx context.Context) *DeviceIterator {
+	return &DeviceIterator{p: pager[Device]{
+		ctx:  ctx,
+		next: c.DevicesURL(0),
+		fetch: func(ctx context.Context, pageURL string) ([]Device, PageInfo, error) {
+			page, err := c.GetDevicePage(ctx, pageURL)
+			if err != nil {
+				return nil, PageInfo{}, err
+			}
+			return page.Devices, page.PageInfo, nil
+		},
+	}}
+}
+
+// Next advances to the next device. It returns false at the end of the
+// listing or on error.
+func (it *DeviceIterator) Next() bool { return it.p.advance() }
+
+// Device returns the current device.
+func (it *DeviceIterator) Device() Device { return it.p.cur }
+
+// Err returns the error that stopped the iteration, if any.
+func (it *DeviceIterator) Err() error { return it.p.err }
+
+// SubscriptionIterator iterates over every tag subscription of a Push
+// application.
+type SubscriptionIterator struct {
+	p pager[Subscription]
+}
+
+// Subscriptions returns an iterator over every tag subscription of the
+// application.
+func (c *Client) Subscriptions(ctx context.Context) *SubscriptionIterator {
+	return &SubscriptionIterator{p: pager[Subscription]{
+		ctx:  ctx,
+		next: c.SubscriptionsURL(0),
+		fetch: func(ctx context.Context, pageURL string) ([]Subscription, PageInfo, error) {
+			page, err := c.GetSubscriptionPage(ctx, pageURL)
+			if err != nil {
+				return nil, PageInfo{}, err
+			}
+			return page.Subscriptions, page.PageInfo, nil
+		},
+	}}
+}
+
+// Next advances to the next subscription. It returns false at the end of
+// the listing or on error.
+func (it *SubscriptionIterator) Next() bool { return it.p.advance() }
+
+// Subscription returns the current subscription.
+func (it *SubscriptionIterator) Subscription() Subscription { return it.p.cur }
+
+// Err returns the error that stopped the iteration, if any.
+func (it *SubscriptionIterator) Err() error { return it.p.err }
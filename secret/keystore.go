@@ -0,0 +1,182 @@
+/**
+ * (C) Copyright IBM Corp. 2022.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// ErrWrongPassphrase is returned when a keystore cannot be decrypted.
+var ErrWrongPassphrase = errors.New("secret: wrong keystore passphrase or corrupted keystore")
+
+const (
+	keystoreVersion = 1
+	// kdfIterations is the PBKDF2-SHA256 work factor recommended by OWASP.
+	kdfIterations = 600_000
+	keySize       = 32
+	saltSize      = 16
+)
+
+// keystoreAAD binds the ciphertext to the format of the file.
+var keystoreAAD = []byte("push-en-migrate keystore v1")
+
+// keystoreFile is the JSON form of a keystore. Its secrets are encrypted
+// together with AES-256-GCM under a key derived from the passphrase with
+// PBKDF2-SHA256.
+type keystoreFile struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// Keystore is a file of named secrets encrypted with a passphrase.
+type Keystore struct {
+	Path       string
+	passphrase string
+	secrets    map[string]string
+}
+
+// OpenKeystore decrypts the keystore at path. If create is set a missing
+// file opens as an empty keystore, which is written by Save.
+func OpenKeystore(path, passphrase string, create bool) (*Keystore, error) {
+	if passphrase == "" {
+		return nil, errors.New("secret: keystore passphrase is empty")
+	}
+	ks := &Keystore{Path: path, passphrase: passphrase, secrets: map[string]string{}}
+	b, err := os.ReadFile(path)
+	if create && errors.Is(err, os.ErrNotExist) {
+		return ks, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("secret: failed to open keystore: %w", err)
+	}
+
+	var f keystoreFile
+	if err := json.Unmarshal(b, &f); err != nil {
+		return nil, fmt.Errorf("secret: keystore %s is not valid: %w", path, err)
+	}
+	if f.Version != keystoreVersion || f.KDF != "pbkdf2-sha256" || f.Iterations <= 0 {
+		return nil, fmt.Errorf("secret: keystore %s has unsupported version %d", path, f.Version)
+	}
+	aead, err := newAEAD(passphrase, f.Salt, f.Iterations)
+	if err != nil {
+		return nil, err
+	}
+	if len(f.Nonce) != aead.NonceSize() {
+		return nil, ErrWrongPassphrase
+	}
+	plain, err := aead.Open(nil, f.Nonce, f.Ciphertext, keystoreAAD)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	if err := json.Unmarshal(plain, &ks.secrets); err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	return ks, nil
+}
+
+func newAEAD(passphrase string, salt []byte, iterations int) (cipher.AEAD, error) {
+	key, err := pbkdf2.Key(sha256.New, passphrase, salt, iterations, keySize)
+	if err != nil {
+		return nil, fmt.Errorf("secret: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Get returns the secret name.
+func (ks *Keystore) Get(name string) (string, error) {
+	v, ok := ks.secrets[name]
+	if !ok {
+		return "", fmt.Errorf("%w: keystore %s has no secret %s", ErrNotFound, ks.Path, name)
+	}
+	return v, nil
+}
+
+// Set stores value as the secret name.
+func (ks *Keystore) Set(name, value string) {
+	ks.secrets[name] = value
+}
+
+// Delete removes the secret name and reports whether it existed.
+func (ks *Keystore) Delete(name string) bool {
+	_, ok := ks.secrets[name]
+	delete(ks.secrets, name)
+	return ok
+}
+
+// Names returns the names of the secrets in sorted order.
+func (ks *Keystore) Names() []string {
+	return slices.Sorted(maps.Keys(ks.secrets))
+}
+
+// Save encrypts the keystore with a new salt and nonce and replaces its
+// file, readable by its owner only.
+func (ks *Keystore) Save() error {
+	plain, err := json.Marshal(ks.secrets)
+	if err != nil {
+		return err
+	}
+	f := keystoreFile{Version: keystoreVersion, KDF: "pbkdf2-sha256", Iterations: kdfIterations, Salt: make([]byte, saltSize)}
+	rand.Read(f.Salt)
+	aead, err := newAEAD(ks.passphrase, f.Salt, f.Iterations)
+	if err != nil {
+		return err
+	}
+	f.Nonce = make([]byte, aead.NonceSize())
+	rand.Read(f.Nonce)
+	f.Ciphertext = aead.Seal(nil, f.Nonce, plain, keystoreAAD)
+
+	b, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(ks.Path), filepath.Base(ks.Path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(b, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), ks.Path)
+}
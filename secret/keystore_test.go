@@ -0,0 +1,135 @@
+/**
+ * (C) Copyright IBM Corp. 2022.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package secret
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const testPassphrase = "correct horse battery staple"
+
+func TestKeystoreSaveOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "push-en-migrate.keystore")
+	ks, err := OpenKeystore(path, testPassphrase, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks.Set("en-apikey", "s3cr3tK3y")
+	ks.Set("push-apikey", "pushK3y")
+	if err := ks.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("keystore mode = %v, want 0600", perm)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "s3cr3tK3y") || strings.Contains(string(b), "en-apikey") {
+		t.Errorf("keystore file holds a secret or its name in clear:\n%s", b)
+	}
+
+	ks, err = OpenKeystore(path, testPassphrase, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := ks.Get("en-apikey"); err != nil || v != "s3cr3tK3y" {
+		t.Errorf("Get(en-apikey) = %q, %v, want s3cr3tK3y", v, err)
+	}
+	if want := []string{"en-apikey", "push-apikey"}; !slices.Equal(ks.Names(), want) {
+		t.Errorf("Names() = %v, want %v", ks.Names(), want)
+	}
+	if _, err := ks.Get("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get(missing) = %v, want ErrNotFound", err)
+	}
+	if !ks.Delete("push-apikey") || ks.Delete("push-apikey") {
+		t.Error("Delete does not report whether the secret existed")
+	}
+}
+
+func TestOpenKeystoreMissing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "push-en-migrate.keystore")
+	if _, err := OpenKeystore(path, testPassphrase, false); err == nil {
+		t.Error("OpenKeystore of a missing file without create succeeded")
+	}
+	if _, err := OpenKeystore(path, "", true); err == nil {
+		t.Error("OpenKeystore with an empty passphrase succeeded")
+	}
+}
+
+func TestOpenKeystoreRejects(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "push-en-migrate.keystore")
+	ks, err := OpenKeystore(path, testPassphrase, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks.Set("en-apikey", "s3cr3tK3y")
+	if err := ks.Save(); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = OpenKeystore(path, "hunter2", false)
+	if !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("OpenKeystore with a wrong passphrase = %v, want ErrWrongPassphrase", err)
+	}
+	if err != nil && strings.Contains(err.Error(), "hunter2") {
+		t.Errorf("error %q includes the passphrase", err)
+	}
+
+	tamper := func(name string, edit func(f *keystoreFile)) {
+		var f keystoreFile
+		if err := json.Unmarshal(b, &f); err != nil {
+			t.Fatal(err)
+		}
+		edit(&f)
+		tampered, err := json.Marshal(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, tampered, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		_, err = OpenKeystore(path, testPassphrase, false)
+		if !errors.Is(err, ErrWrongPassphrase) {
+			t.Errorf("%s: OpenKeystore = %v, want ErrWrongPassphrase", name, err)
+		}
+		if err != nil && (strings.Contains(err.Error(), "s3cr3tK3y") || strings.Contains(err.Error(), testPassphrase)) {
+			t.Errorf("%s: error %q includes a secret", name, err)
+		}
+	}
+	tamper("ciphertext", func(f *keystoreFile) { f.Ciphertext[len(f.Ciphertext)/2] ^= 1 })
+	tamper("tag", func(f *keystoreFile) { f.Ciphertext[len(f.Ciphertext)-1] ^= 1 })
+	tamper("nonce", func(f *keystoreFile) { f.Nonce[0] ^= 1 })
+	tamper("salt", func(f *keystoreFile) { f.Salt[0] ^= 1 })
+	tamper("short nonce", func(f *keystoreFile) { f.Nonce = f.Nonce[:4] })
+}
@@ -0,0 +1,206 @@
+/**
+ * (C) Copyright IBM Corp. 2022.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package secret resolves API keys and secrets from where they are kept:
+// a file such as a Kubernetes secret mount, an environment variable, the
+// standard input or an encrypted Keystore. A reference names the source
+// with a scheme, file:<path>, env:<name>, stdin:, stdin:<name> or
+// keystore:<name>; any other value is the secret itself.
+//
+// Errors never include the value of a secret.
+package secret
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Schemes of references.
+const (
+	SchemeFile     = "file"
+	SchemeEnv      = "env"
+	SchemeStdin    = "stdin"
+	SchemeKeystore = "keystore"
+)
+
+// ErrNotFound is returned for a reference to a secret that does not exist.
+var ErrNotFound = errors.New("secret: not found")
+
+// Parse splits ref into its scheme and the rest. The scheme is empty if ref
+// is not a reference.
+func Parse(ref string) (scheme, rest string) {
+	scheme, rest, ok := strings.Cut(ref, ":")
+	if !ok {
+		return "", ref
+	}
+	switch scheme {
+	case SchemeFile:
+		// Accept file:///path as well as file:/path.
+		return scheme, strings.TrimPrefix(rest, "//")
+	case SchemeEnv, SchemeStdin, SchemeKeystore:
+		return scheme, rest
+	}
+	return "", ref
+}
+
+// IsReference reports whether v is a reference rather than a secret.
+func IsReference(v string) bool {
+	scheme, _ := Parse(v)
+	return scheme != ""
+}
+
+// Check reports whether ref is well formed without resolving it.
+func Check(ref string) error {
+	scheme, rest := Parse(ref)
+	switch {
+	case scheme == SchemeFile && rest == "":
+		return errors.New("file: needs a path, such as file:/run/secrets/apikey")
+	case scheme == SchemeEnv && rest == "":
+		return errors.New("env: needs a variable name, such as env:EN_APIKEY")
+	case scheme == SchemeKeystore && rest == "":
+		return errors.New("keystore: needs a secret name, such as keystore:en-apikey")
+	}
+	return nil
+}
+
+// Resolver resolves references and remembers their secrets. The standard
+// input is read the first time it is needed and the keystore opened once.
+// It is safe for concurrent use.
+type Resolver struct {
+	// Stdin is read by stdin: references, os.Stdin if nil. stdin: takes
+	// all of it as one secret and stdin:<name> the value of the line
+	// <name>=<value>.
+	Stdin io.Reader
+	// Keystore opens the keystore of keystore: references. It may resolve
+	// references other than keystore: with r.
+	Keystore func(r *Resolver) (*Keystore, error)
+
+	mu       sync.Mutex
+	resolved map[string]string
+
+	stdinOnce sync.Once
+	stdin     []byte
+	stdinErr  error
+
+	keystoreMu sync.Mutex
+	keystore   *Keystore
+}
+
+// Resolve returns the secret ref refers to, or ref itself if it is not a
+// reference. Surrounding white space such as the trailing newline of a
+// file is removed.
+func (r *Resolver) Resolve(ref string) (string, error) {
+	scheme, rest := Parse(ref)
+	if scheme == "" {
+		return ref, nil
+	}
+	if err := Check(ref); err != nil {
+		return "", err
+	}
+
+	r.mu.Lock()
+	v, ok := r.resolved[ref]
+	r.mu.Unlock()
+	if ok {
+		return v, nil
+	}
+
+	var err error
+	switch scheme {
+	case SchemeFile:
+		v, err = readFile(rest)
+	case SchemeEnv:
+		if v, ok = os.LookupEnv(rest); !ok {
+			err = fmt.Errorf("%w: environment variable %s is not set", ErrNotFound, rest)
+		}
+		v = strings.TrimSpace(v)
+	case SchemeStdin:
+		v, err = r.fromStdin(rest)
+	case SchemeKeystore:
+		v, err = r.fromKeystore(rest)
+	}
+	if err == nil && v == "" {
+		err = fmt.Errorf("secret: %s is empty", ref)
+	}
+	if err != nil {
+		return "", err
+	}
+	r.mu.Lock()
+	if r.resolved == nil {
+		r.resolved = map[string]string{}
+	}
+	r.resolved[ref] = v
+	r.mu.Unlock()
+	return v, nil
+}
+
+func readFile(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("%w: file %s does not exist", ErrNotFound, path)
+	}
+	if err != nil {
+		return "", fmt.Errorf("secret: %w", err)
+	}
+	return string(bytes.TrimSpace(b)), nil
+}
+
+func (r *Resolver) fromStdin(name string) (string, error) {
+	r.stdinOnce.Do(func() {
+		in := r.Stdin
+		if in == nil {
+			in = os.Stdin
+		}
+		r.stdin, r.stdinErr = io.ReadAll(in)
+	})
+	if r.stdinErr != nil {
+		return "", fmt.Errorf("secret: failed to read standard input: %w", r.stdinErr)
+	}
+	if name == "" {
+		return string(bytes.TrimSpace(r.stdin)), nil
+	}
+
+	sc := bufio.NewScanner(bytes.NewReader(r.stdin))
+	for sc.Scan() {
+		key, value, ok := strings.Cut(sc.Text(), "=")
+		if ok && strings.TrimSpace(key) == name {
+			return strings.TrimSpace(value), nil
+		}
+	}
+	return "", fmt.Errorf("%w: no line %s=<value> on standard input", ErrNotFound, name)
+}
+
+func (r *Resolver) fromKeystore(name string) (string, error) {
+	r.keystoreMu.Lock()
+	defer r.keystoreMu.Unlock()
+	if r.keystore == nil {
+		if r.Keystore == nil {
+			return "", errors.New("secret: no keystore configured")
+		}
+		ks, err := r.Keystore(r)
+		if err != nil {
+			return "", err
+		}
+		r.keystore = ks
+	}
+	return r.keystore.Get(name)
+}
@@ -0,0 +1,136 @@
+/**
+ * (C) Copyright IBM Corp. 2022.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package secret
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testSecret must never appear in an error.
+const testSecret = "s3cr3tK3y"
+
+func TestResolve(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "apikey")
+	if err := os.WriteFile(file, []byte(testSecret+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TEST_SECRET_APIKEY", " "+testSecret+" ")
+
+	r := &Resolver{Stdin: strings.NewReader("PUSH_APIKEY=other\n EN_APIKEY = " + testSecret + "\n")}
+	for _, ref := range []string{
+		"file:" + file,
+		"file://" + file,
+		"env:TEST_SECRET_APIKEY",
+		"stdin:EN_APIKEY",
+		testSecret,
+	} {
+		if v, err := r.Resolve(ref); err != nil || v != testSecret {
+			t.Errorf("Resolve(%q) = %q, %v, want the secret", ref, v, err)
+		}
+	}
+	// stdin is read once, so its other lines remain available.
+	if v, err := r.Resolve("stdin:PUSH_APIKEY"); err != nil || v != "other" {
+		t.Errorf("Resolve(stdin:PUSH_APIKEY) = %q, %v, want other", v, err)
+	}
+
+	r = &Resolver{Stdin: strings.NewReader(testSecret + "\n")}
+	if v, err := r.Resolve("stdin:"); err != nil || v != testSecret {
+		t.Errorf("Resolve(stdin:) = %q, %v, want the secret", v, err)
+	}
+}
+
+func TestResolveErrors(t *testing.T) {
+	dir := t.TempDir()
+	empty := filepath.Join(dir, "empty")
+	if err := os.WriteFile(empty, []byte("\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TEST_SECRET_EMPTY", "  ")
+	stdin := "PUSH_APIKEY=" + testSecret + "\n" + testSecret + "\nEN_APIKEY" + testSecret + "\n"
+
+	tests := []struct {
+		ref      string
+		notFound bool
+	}{
+		{"file:" + filepath.Join(dir, "missing"), true},
+		{"file:" + dir, false},
+		{"file:" + empty, false},
+		{"file:", false},
+		{"env:TEST_SECRET_UNSET", true},
+		{"env:TEST_SECRET_EMPTY", false},
+		{"env:", false},
+		{"stdin:EN_APIKEY", true},
+		{"keystore:en-apikey", false},
+		{"keystore:", false},
+	}
+	for _, tt := range tests {
+		r := &Resolver{Stdin: strings.NewReader(stdin)}
+		_, err := r.Resolve(tt.ref)
+		if err == nil {
+			t.Errorf("Resolve(%q) succeeded", tt.ref)
+			continue
+		}
+		if errors.Is(err, ErrNotFound) != tt.notFound {
+			t.Errorf("Resolve(%q) = %v, ErrNotFound %t, want %t", tt.ref, err, errors.Is(err, ErrNotFound), tt.notFound)
+		}
+		if strings.Contains(err.Error(), testSecret) {
+			t.Errorf("Resolve(%q) error %q includes the secret", tt.ref, err)
+		}
+	}
+}
+
+func TestResolveKeystore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "push-en-migrate.keystore")
+	ks, err := OpenKeystore(path, testPassphrase, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks.Set("en-apikey", testSecret)
+	if err := ks.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	opened := 0
+	r := &Resolver{
+		Stdin: strings.NewReader("PASSPHRASE=" + testPassphrase + "\n"),
+		Keystore: func(r *Resolver) (*Keystore, error) {
+			opened++
+			passphrase, err := r.Resolve("stdin:PASSPHRASE")
+			if err != nil {
+				return nil, err
+			}
+			return OpenKeystore(path, passphrase, false)
+		},
+	}
+	for range 2 {
+		if v, err := r.Resolve("keystore:en-apikey"); err != nil || v != testSecret {
+			t.Errorf("Resolve(keystore:en-apikey) = %q, %v, want the secret", v, err)
+		}
+	}
+	_, err = r.Resolve("keystore:push-apikey")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("Resolve(keystore:push-apikey) = %v, want ErrNotFound", err)
+	}
+	if opened != 1 {
+		t.Errorf("keystore opened %d times, want 1", opened)
+	}
+}
@@ -8,4 +8,28 @@ export EN_ANDROID_DESTINATION_ID="EN_ANDROID_DESTINATION_ID"
 export PUSH_INSTANCE_REGION="PUSH_INSTANCE_REGION"
 export PUSH_INSTANCE_ID="PUSH_INSTANCE_ID"
 export PUSH_APIKEY="PUSH_API_KEY"
+# Only needed with --push-auth client-secret or --push-auth app-secret.
 export PUSH_CLIENT_SECRET="PUSH_CLIENT_SECRET"
+# export PUSH_APP_SECRET="PUSH_APP_SECRET"
+
+# Optional IAM token endpoint, by default iam.cloud.ibm.com or iam.test.cloud.ibm.com
+# for the stage region. Use private.iam.cloud.ibm.com over the private network.
+# PUSH_IAM_URL and EN_IAM_URL override it for one side.
+# export IAM_URL="private.iam.cloud.ibm.com"
+
+# Optional trusted profile authentication instead of the API key, using the compute
+# resource token mounted in the pod (/var/run/secrets/tokens/vault-token by default).
+# export PUSH_TRUSTED_PROFILE_ID="Profile-..."
+# export PUSH_CR_TOKEN_FILE="/var/run/secrets/tokens/vault-token"
+# export EN_TRUSTED_PROFILE_ID="Profile-..."
+# export EN_CR_TOKEN_FILE="/var/run/secrets/tokens/vault-token"
+
+# These settings may instead be kept per environment in profiles of push-en-migrate.toml,
+# selected with --profile. Variables exported here take precedence over the profile.
+
+# API keys and secrets may refer to where they are kept instead of being written here:
+# file:<path>, env:<variable>, stdin: or stdin:<name>, or keystore:<name> for the encrypted
+# keystore managed with "push-en-migrate keystore set <name>".
+# export EN_APIKEY="file:/run/secrets/en-apikey"
+# export PUSH_EN_MIGRATE_KEYSTORE="push-en-migrate.keystore"
+# export PUSH_EN_MIGRATE_KEYSTORE_PASSPHRASE="file:/run/secrets/keystore-passphrase"
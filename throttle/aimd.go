@@ -0,0 +1,125 @@
+/**
+ * (C) Copyright IBM Corp. 2022.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package throttle
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// AIMD adapts the limit of a Limiter to the health of the API using
+// additive increase, multiplicative decrease. The limit grows by one after
+// a full limit's worth of healthy responses in a row, and halves on a
+// throttled, server error or network failure response.
+type AIMD struct {
+	Limiter *Limiter
+	Min     int
+	Max     int
+	// TargetLatency is the average latency above which the limit stops
+	// growing.
+	TargetLatency time.Duration
+	// Cooldown is the minimum time between two decreases, so that a burst
+	// of failures from requests already in flight only counts once.
+	Cooldown time.Duration
+	// OnChange, if set, is called with every new limit.
+	OnChange func(limit int)
+
+	mu           sync.Mutex
+	healthy      int
+	latency      time.Duration
+	lastDecrease time.Time
+}
+
+// Observe records the outcome of one request. A zero status is a request
+// that failed without a response.
+func (a *AIMD) Observe(status int, latency time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	limit := a.Limiter.Limit()
+	if Unhealthy(status) {
+		a.healthy = 0
+		now := time.Now()
+		if now.Sub(a.lastDecrease) < a.Cooldown {
+			return
+		}
+		a.lastDecrease = now
+		a.set(max(limit/2, a.Min), limit)
+		return
+	}
+
+	// Exponentially weighted moving average over roughly the last ten
+	// responses.
+	if a.latency == 0 {
+		a.latency = latency
+	} else {
+		a.latency += (latency - a.latency) / 10
+	}
+	if a.TargetLatency > 0 && a.latency > a.TargetLatency {
+		a.healthy = 0
+		return
+	}
+
+	a.healthy++
+	if a.healthy >= limit {
+		a.healthy = 0
+		a.set(min(limit+1, a.Max), limit)
+	}
+}
+
+func (a *AIMD) set(limit, old int) {
+	if limit == old {
+		return
+	}
+	a.Limiter.SetLimit(limit)
+	if a.OnChange != nil {
+		a.OnChange(limit)
+	}
+}
+
+// Unhealthy reports whether a response status means the API is overloaded:
+// 429, any 5xx, or no response at all.
+func Unhealthy(status int) bool {
+	return status == 0 || status == http.StatusTooManyRequests || status >= 500
+}
+
+// Transport is an http.RoundTripper that reports the status and latency of
+// every request to Observe.
+type Transport struct {
+	Base    http.RoundTripper
+	Observe func(status int, latency time.Duration)
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	start := time.Now()
+	resp, err := base.RoundTrip(req)
+	status := 0
+	if err == nil {
+		status = resp.StatusCode
+	}
+	if req.Context().Err() == nil {
+		t.Observe(status, time.Since(start))
+	}
+	return resp, err
+}
@@ -0,0 +1,120 @@
+/**
+ * (C) Copyright IBM Corp. 2022.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package throttle limits how hard the migration drives the Event
+// Notifications API.
+package throttle
+
+import (
+	"context"
+	"sync"
+)
+
+// Limiter bounds the number of operations in flight. Unlike a plain
+// semaphore its limit can be changed while it is in use; lowering it lets
+// running operations finish and holds back new ones until enough have been
+// released. It can also be paused, which holds back every new operation.
+type Limiter struct {
+	mu      sync.Mutex
+	limit   int
+	inUse   int
+	paused  bool
+	changed chan struct{}
+}
+
+// NewLimiter returns a Limiter allowing n operations at once.
+func NewLimiter(n int) *Limiter {
+	return &Limiter{limit: n, changed: make(chan struct{})}
+}
+
+// Acquire blocks until an operation may start or ctx is done.
+func (l *Limiter) Acquire(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		if !l.paused && l.inUse < l.limit {
+			l.inUse++
+			l.mu.Unlock()
+			return nil
+		}
+		changed := l.changed
+		l.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Release ends an operation started by Acquire.
+func (l *Limiter) Release() {
+	l.mu.Lock()
+	l.inUse--
+	l.broadcast()
+	l.mu.Unlock()
+}
+
+// SetLimit changes the number of operations allowed at once.
+func (l *Limiter) SetLimit(n int) {
+	l.mu.Lock()
+	l.limit = n
+	l.broadcast()
+	l.mu.Unlock()
+}
+
+// Pause holds back new operations until Resume is called. Operations in
+// flight are not affected.
+func (l *Limiter) Pause() {
+	l.mu.Lock()
+	l.paused = true
+	l.mu.Unlock()
+}
+
+// Resume lets new operations start again after Pause.
+func (l *Limiter) Resume() {
+	l.mu.Lock()
+	l.paused = false
+	l.broadcast()
+	l.mu.Unlock()
+}
+
+// Paused reports whether the Limiter is paused.
+func (l *Limiter) Paused() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.paused
+}
+
+// Limit returns the number of operations allowed at once.
+func (l *Limiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
+
+// InUse returns the number of operations in flight.
+func (l *Limiter) InUse() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.inUse
+}
+
+// broadcast wakes every waiting Acquire. l.mu must be held.
+func (l *Limiter) broadcast() {
+	close(l.changed)
+	l.changed = make(chan struct{})
+}